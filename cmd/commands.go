@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/breach"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/config"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/repository"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/utils"
+)
+
+// commands holds the one-off maintenance commands which can be run instead of the server,
+// e.g. `./bin/main hash-refresh-tokens`.
+var commands = map[string]func(args []string) error{
+	"hash-refresh-tokens": hashRefreshTokens,
+	"rotate-keys":         rotateKeys,
+	"build-breach-filter": buildBreachFilter,
+}
+
+// runCommand runs the maintenance command with the given name and exits the process.
+func runCommand(name string, args []string) {
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+		os.Exit(2)
+	}
+	if err := cmd(args); err != nil {
+		utils.Log.Error("command failed", "command", name, "err", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// hashRefreshTokens replaces the plaintext refresh tokens stored before tokens got hashed.
+func hashRefreshTokens(args []string) error {
+	hashed, err := repository.HashPlaintextRefreshTokens(context.Background())
+	if err != nil {
+		return err
+	}
+	utils.Log.Info("refresh tokens hashed", "rows", hashed)
+	return nil
+}
+
+// rotateKeys creates a new signing key in JWT_KEYS_DIR. Running servers start signing with it on their
+// next reload of the directory, or right away after a SIGHUP, while the older keys keep verifying.
+func rotateKeys(args []string) error {
+	path, err := config.GenerateKeyFile()
+	if err != nil {
+		return err
+	}
+	utils.Log.Info("signing key created", "path", path)
+	return nil
+}
+
+// buildBreachFilter converts a Pwned Passwords hash list or a directory of range files into a bloom filter file
+// for BREACHED_PASSWORDS_FILE. Usage: build-breach-filter <input> <output> [false positive rate, default 0.001].
+// Hashes seen fewer than BREACHED_PASSWORDS_MIN_COUNT times are left out.
+func buildBreachFilter(args []string) error {
+	if len(args) < 2 || len(args) > 3 {
+		return fmt.Errorf("usage: build-breach-filter <input> <output> [false positive rate]")
+	}
+	falsePositiveRate := 0.001
+	if len(args) == 3 {
+		var err error
+		if falsePositiveRate, err = strconv.ParseFloat(args[2], 64); err != nil {
+			return fmt.Errorf("invalid false positive rate: %w", err)
+		}
+	}
+	if err := breach.BuildFilterFile(args[0], args[1], config.Envs.BREACHED_PASSWORDS_MIN_COUNT, falsePositiveRate); err != nil {
+		return err
+	}
+	utils.Log.Info("breach filter created", "path", args[1])
+	return nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"net/http"
+	"os"
 
 	"github.com/joho/godotenv"
 	"github.com/the-arcade-01/golang-jwt-authentication/internal/api"
@@ -23,7 +24,12 @@ func init() {
 }
 
 // main initializes the server and starts listening on port 8080.
+// When a command name is passed as the first argument, that command is run instead.
 func main() {
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1], os.Args[2:])
+	}
+
 	server := api.NewServer()
 	utils.Log.Info("server running on port:8080")
 	err := http.ListenAndServe(":8080", server.Router)
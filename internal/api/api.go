@@ -6,9 +6,11 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
-	"github.com/go-chi/jwtauth/v5"
 	"github.com/the-arcade-01/golang-jwt-authentication/internal/config"
 	"github.com/the-arcade-01/golang-jwt-authentication/internal/handlers"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/ratelimit"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/repository"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/validator"
 )
 
 type Server struct {
@@ -20,48 +22,101 @@ type Server struct {
 // - Heartbeat: Responds to /ping requests to check server health.
 // - Timeout: Sets a timeout for requests to 1 minute.
 // - Recoverer: Recovers from panics and returns a 500 status code.
+// - clientIP: Stores the IP address of the client in the request context.
 // - requestLogger: Logs incoming requests.
 // - CORS: Configures Cross-Origin Resource Sharing with specified options.
 func (s *Server) mountMiddlewares() {
 	s.Router.Use(middleware.Heartbeat("/ping"))
 	s.Router.Use(middleware.Timeout(1 * time.Minute))
 	s.Router.Use(middleware.Recoverer)
+	s.Router.Use(clientIP)
 	s.Router.Use(requestLogger)
 	s.Router.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{config.Envs.WEB_URL},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Set-Cookie"},
+		ExposedHeaders:   []string{"Set-Cookie", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 }
 
 // mountHandlers sets up the routing for the authentication-related endpoints.
-// It initializes the authentication handlers and defines the routes for user
-// creation, login, and greeting. It also sets up a group of routes that require
-// JWT authentication, including routes for getting user information, logging out,
-// deleting a user, and refreshing tokens.
+// It defines the public routes for signup, the login methods, the links sent by email and
+// the token endpoints, and a group of routes which require a valid, unrevoked access token.
+// Signup, logins and the routes sending emails are rate limited per IP address, the logins by email
+// address also per address, and the protected routes per user. The admin routes and the .well-known documents are mounted separately.
 func (s *Server) mountHandlers() {
 	authHandlers := handlers.NewAuthHandlers()
+	limits := ratelimit.NewStore()
+	emailIPLimit := rateLimit(limits, "email_ip", config.Envs.RATE_LIMIT_EMAIL_IP, byIP)
 	authRouter := chi.NewRouter()
 	authRouter.Get("/greet", authHandlers.Greet)
-	authRouter.Post("/users", authHandlers.CreateUser)
-	authRouter.Post("/login", authHandlers.LoginUser)
+	authRouter.With(rateLimit(limits, "signup_ip", config.Envs.RATE_LIMIT_SIGNUP_IP, byIP)).Post("/users", authHandlers.CreateUser)
+	authRouter.Post("/users/verify", authHandlers.VerifyEmail)
+	authRouter.With(emailIPLimit).Post("/users/verify/resend", authHandlers.ResendVerificationEmail)
+	authRouter.Post("/users/unlock", authHandlers.UnlockAccount)
+	authRouter.Post("/users/email/confirm", authHandlers.ConfirmEmailChange)
+	authRouter.Post("/users/email/cancel", authHandlers.CancelEmailChange)
+	authRouter.With(emailIPLimit).Post("/password/forgot", authHandlers.ForgotPassword)
+	authRouter.Post("/password/reset", authHandlers.ResetPassword)
+	loginIPLimit := rateLimit(limits, "login_ip", config.Envs.RATE_LIMIT_LOGIN_IP, byIP)
+	loginEmailLimit := rateLimit(limits, "login_email", config.Envs.RATE_LIMIT_LOGIN_EMAIL, byEmail)
+	authRouter.With(loginIPLimit, loginEmailLimit).Post("/login", authHandlers.LoginUser)
+	authRouter.With(loginIPLimit).Post("/login/mfa", authHandlers.LoginMFA)
+	authRouter.With(emailIPLimit).Post("/login/magic", authHandlers.RequestMagicLink)
+	authRouter.With(loginIPLimit).Post("/login/magic/verify", authHandlers.VerifyMagicLink)
+	authRouter.With(emailIPLimit).Post("/login/otp", authHandlers.RequestEmailOTP)
+	authRouter.With(loginIPLimit, loginEmailLimit).Post("/login/otp/verify", authHandlers.VerifyEmailOTP)
+	authRouter.With(loginIPLimit).Post("/webauthn/login/begin", authHandlers.BeginWebAuthnLogin)
+	authRouter.With(loginIPLimit).Post("/webauthn/login/finish", authHandlers.FinishWebAuthnLogin)
+	authRouter.With(rateLimit(limits, "refresh_ip", config.Envs.RATE_LIMIT_REFRESH_IP, byIP)).Post("/tokens/refresh", authHandlers.RefreshToken)
+	authRouter.With(requireIntrospectionClient).Post("/introspect", authHandlers.IntrospectToken)
+	authRouter.Post("/revoke", authHandlers.RevokeToken)
 	authRouter.Group(func(r chi.Router) {
-		r.Use(jwtauth.Verifier(config.NewAppConfig().JWTAuth))
-		r.Use(jwtauth.Authenticator(config.NewAppConfig().JWTAuth))
+		r.Use(verifier(config.NewAppConfig().KeyRing))
+		r.Use(authenticator)
 		r.Use(parseClaims)
+		r.Use(rejectRevoked(repository.NewRevocationStore()))
+		r.Use(rateLimit(limits, "user", config.Envs.RATE_LIMIT_USER, byUserID))
 
 		r.Get("/users/me", authHandlers.GetUserByID)
+		r.Put("/users/me/password", authHandlers.ChangePassword)
+		r.Put("/users/me/email", authHandlers.RequestEmailChange)
 		r.Post("/logout", authHandlers.LogoutUser)
 		r.Delete("/users", authHandlers.DeleteUser)
-		r.Post("/tokens/refresh", authHandlers.RefreshToken)
+		r.Post("/webauthn/register/begin", authHandlers.BeginWebAuthnRegistration)
+		r.Post("/webauthn/register/finish", authHandlers.FinishWebAuthnRegistration)
+		r.Get("/webauthn/credentials", authHandlers.GetWebAuthnCredentials)
+		r.Delete("/webauthn/credentials/{credentialID}", authHandlers.DeleteWebAuthnCredential)
+
+		if len(config.Envs.MFA_ENCRYPTION_KEY) != 0 {
+			r.Post("/mfa/totp/enroll", authHandlers.EnrollTOTP)
+			r.Post("/mfa/totp/confirm", authHandlers.ConfirmTOTP)
+			r.Delete("/mfa/totp", authHandlers.DisableTOTP)
+			r.Post("/mfa/recovery-codes", authHandlers.RegenerateRecoveryCodes)
+		}
 	})
 	s.Router.Mount("/api/auth", authRouter)
+
+	if config.Envs.ADMIN_API_KEY != "" {
+		adminHandlers := handlers.NewAdminHandlers()
+		adminRouter := chi.NewRouter()
+		adminRouter.Use(requireAdminKey)
+		adminRouter.Post("/tokens/revoke", adminHandlers.RevokeAccessToken)
+		adminRouter.Post("/users/{userID}/unlock", adminHandlers.UnlockUser)
+		s.Router.Mount("/api/admin", adminRouter)
+	}
+
+	wellKnownHandlers := handlers.NewWellKnownHandlers()
+	s.Router.Get("/.well-known/jwks.json", wellKnownHandlers.JWKS)
+	s.Router.Get("/.well-known/openid-configuration", wellKnownHandlers.OpenIDConfiguration)
 }
 
 func NewServer() *Server {
+	// Loads the banned and breached passwords at startup instead of on the first signup.
+	validator.NewPasswordPolicy()
+
 	s := &Server{
 		Router: chi.NewMux(),
 	}
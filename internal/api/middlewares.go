@@ -2,11 +2,19 @@ package api
 
 import (
 	"context"
+	"crypto/subtle"
+	"fmt"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/jwtauth/v5"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/config"
 	"github.com/the-arcade-01/golang-jwt-authentication/internal/models"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/repository"
 	"github.com/the-arcade-01/golang-jwt-authentication/internal/utils"
 )
 
@@ -39,13 +47,82 @@ func requestLogger(next http.Handler) http.Handler {
 	})
 }
 
-// parseClaims extracts the user ID from the JWT claims and adds it to the request context.
-// If the token is invalid, it responds with an unauthorized error.
+// clientIP stores the IP address of the client in the request context under utils.ClientIPCtxKey.
+// Behind a reverse proxy, REAL_IP_HEADER names the header the proxy puts the client address into. For a list like
+// X-Forwarded-For the last entry is taken, as it was added by our proxy and can't be forged by the client.
+func clientIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+		if config.Envs.REAL_IP_HEADER != "" {
+			if values := strings.Split(r.Header.Get(config.Envs.REAL_IP_HEADER), ","); len(values) > 0 {
+				if addr := net.ParseIP(strings.TrimSpace(values[len(values)-1])); addr != nil {
+					ip = addr.String()
+				}
+			}
+		}
+		ctx := context.WithValue(r.Context(), utils.ClientIPCtxKey, ip)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// verifier works like jwtauth.Verifier but verifies the token with the key of the KeyRing named
+// by the token's kid header, so tokens signed by previous keys stay valid during a key rotation.
+// Unlike jwtauth.Verifier it only reads the Authorization header, as the jwt cookie holds the refresh token.
+// The token and the verification error are stored in the request context the same way jwtauth does,
+// so jwtauth.FromContext keeps working.
+func verifier(keyRing *config.KeyRing) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokenString := jwtauth.TokenFromHeader(r)
+
+			var token jwt.Token
+			err := jwtauth.ErrNoTokenFound
+			if tokenString != "" {
+				token, err = keyRing.Verify(tokenString)
+			}
+			ctx := jwtauth.NewContext(r.Context(), token, err)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// authenticator responds with an unauthorized error for requests whose token couldn't be verified by the verifier.
+func authenticator(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, _, err := jwtauth.FromContext(r.Context())
+		if err != nil || token == nil {
+			models.ResponseWithJSON(w, http.StatusUnauthorized, &models.ErrorResponse{
+				Success: false,
+				Status:  http.StatusUnauthorized,
+				Error:   "Invalid token, please login again",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// parseClaims extracts the user ID (sub) and session ID from the JWT claims and adds them to the request context.
+// If the token is invalid, was issued by another issuer or for another audience, or isn't an access token,
+// it responds with an unauthorized error.
 func parseClaims(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		_, claims, err := jwtauth.FromContext(r.Context())
-		userID, ok := claims["userID"].(float64)
-		if err != nil && !ok {
+		token, claims, err := jwtauth.FromContext(r.Context())
+		if err == nil && token != nil {
+			err = config.ValidateIssuerAndAudience(token)
+		}
+		if err == nil {
+			err = config.ValidateTokenType(token, utils.AccessTokenType)
+		}
+		var userID int
+		if err == nil {
+			userID, err = strconv.Atoi(token.Subject())
+		}
+		sessionID, ok := claims["sid"].(string)
+		if err != nil || !ok || sessionID == "" {
 			models.ResponseWithJSON(w, http.StatusUnauthorized, &models.ErrorResponse{
 				Success: false,
 				Status:  http.StatusUnauthorized,
@@ -55,7 +132,62 @@ func parseClaims(next http.Handler) http.Handler {
 		}
 
 		ctx := context.WithValue(r.Context(), utils.UserIDCtxKey, userID)
+		ctx = context.WithValue(ctx, utils.SessionIDCtxKey, sessionID)
+		ctx = context.WithValue(ctx, utils.TokenIDCtxKey, token.JwtID())
+		ctx = context.WithValue(ctx, utils.TokenExpireTimeCtxKey, token.Expiration().Unix())
 		r = r.WithContext(ctx)
 		next.ServeHTTP(w, r)
 	})
 }
+
+// rejectRevoked responds with an unauthorized error when the access token's jti is on the
+// revocation denylist, e.g. because the user logged out. It must run after parseClaims.
+func rejectRevoked(store repository.RevocationStoreInterface) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokenID := r.Context().Value(utils.TokenIDCtxKey).(string)
+			sessionID := r.Context().Value(utils.SessionIDCtxKey).(string)
+			revoked, err := repository.IsAccessTokenRevoked(r.Context(), store, tokenID, sessionID)
+			if err != nil {
+				models.ResponseWithJSON(w, http.StatusInternalServerError, models.NewErrorResponse(http.StatusInternalServerError, fmt.Errorf("please try again later")))
+				return
+			}
+			if revoked {
+				models.ResponseWithJSON(w, http.StatusUnauthorized, &models.ErrorResponse{
+					Success: false,
+					Status:  http.StatusUnauthorized,
+					Error:   "Invalid token, please login again",
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireAdminKey only lets requests through which send the ADMIN_API_KEY as bearer token.
+func requireAdminKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := jwtauth.TokenFromHeader(r)
+		if key == "" || subtle.ConstantTimeCompare([]byte(key), []byte(config.Envs.ADMIN_API_KEY)) != 1 {
+			models.ResponseWithJSON(w, http.StatusUnauthorized, models.NewErrorResponse(http.StatusUnauthorized, fmt.Errorf("invalid admin key")))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireIntrospectionClient authenticates the calling client with one of the INTROSPECTION_CLIENTS
+// credentials, sent with HTTP Basic authentication as RFC 6749 client_secret_basic.
+func requireIntrospectionClient(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientID, clientSecret, ok := r.BasicAuth()
+		secret, known := config.Envs.INTROSPECTION_CLIENTS[clientID]
+		if !ok || !known || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(secret)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="introspection"`)
+			models.ResponseWithJSON(w, http.StatusUnauthorized, models.NewErrorResponse(http.StatusUnauthorized, fmt.Errorf("invalid_client")))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/config"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/models"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/ratelimit"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/utils"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/validator"
+)
+
+// maxRateLimitBodySize is how much of a request body is read to find the key of a rate limit.
+const maxRateLimitBodySize = 1 << 20
+
+// rateLimitKey returns the key of the bucket a request counts against, or an empty string to not limit the request.
+type rateLimitKey func(r *http.Request) string
+
+// byIP keys a rate limit by the client IP address set by the clientIP middleware.
+func byIP(r *http.Request) string {
+	ip, _ := r.Context().Value(utils.ClientIPCtxKey).(string)
+	return ip
+}
+
+// byUserID keys a rate limit by the user ID set by parseClaims, so it can only be used in the protected group.
+func byUserID(r *http.Request) string {
+	userID, ok := r.Context().Value(utils.UserIDCtxKey).(int)
+	if !ok {
+		return ""
+	}
+	return strconv.Itoa(userID)
+}
+
+// byEmail keys a rate limit by the normalised "email" field of a JSON body. The body is restored,
+// so the handler can still read it. Requests without an email aren't limited by this key.
+func byEmail(r *http.Request) string {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRateLimitBodySize))
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+	var fields struct {
+		Email string `json:"email"`
+	}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return ""
+	}
+	return validator.NormalizeEmail(fields.Email)
+}
+
+// rateLimit limits the requests per key with a token bucket of the given limit, see ratelimit.Policy.
+// It sends the RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy headers, and answers
+// requests over the limit with 429 and a Retry-After header. When several limits apply to a route, the headers
+// describe the one with the fewest remaining requests. A nil limit turns the middleware off. If the store fails,
+// requests are let through, so an outage of the store doesn't take down the login.
+func rateLimit(store ratelimit.StoreInterface, name string, limit *config.RateLimit, key rateLimitKey) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limit == nil {
+			return next
+		}
+		policy := &ratelimit.Policy{Name: name, Limit: limit.Limit, Period: limit.Period}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k := key(r)
+			if k == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			res, err := store.Take(r.Context(), name+":"+k, policy)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if remaining := w.Header().Get("RateLimit-Remaining"); remaining == "" || mustAtoi(remaining) >= res.Remaining {
+				w.Header().Set("RateLimit-Limit", strconv.Itoa(policy.Limit))
+				w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+				w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+				w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit, ceilSeconds(policy.Period)))
+			}
+			if !res.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+				models.ResponseWithJSON(w, http.StatusTooManyRequests, models.NewErrorResponse(http.StatusTooManyRequests, fmt.Errorf("too many requests, please try again later")))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+func mustAtoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/config"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/ratelimit"
+)
+
+// failingStore is a rate limit store which is down.
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, policy *ratelimit.Policy) (*ratelimit.Result, error) {
+	return nil, errors.New("store is down")
+}
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+func byHeader(r *http.Request) string {
+	return r.Header.Get("X-Test-Key")
+}
+
+func serve(handler http.Handler, key string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("X-Test-Key", key)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	config.Envs = &config.AppEnvs{RATE_LIMIT_STORE: "memory"}
+	handler := rateLimit(ratelimit.NewStore(), "test_headers", &config.RateLimit{Limit: 2, Period: time.Minute}, byHeader)(okHandler)
+
+	for i, wantRemaining := range []string{"1", "0"} {
+		rec := serve(handler, "a", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d: got status %d", i+1, rec.Code)
+		}
+		headers := map[string]string{
+			"RateLimit-Limit":     "2",
+			"RateLimit-Remaining": wantRemaining,
+			"RateLimit-Policy":    "2;w=60",
+		}
+		for name, want := range headers {
+			if got := rec.Header().Get(name); got != want {
+				t.Errorf("request %d: got %s %q, want %q", i+1, name, got, want)
+			}
+		}
+		if rec.Header().Get("RateLimit-Reset") == "" || rec.Header().Get("Retry-After") != "" {
+			t.Errorf("request %d: got headers %v", i+1, rec.Header())
+		}
+	}
+
+	rec := serve(handler, "a", "")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("request over the limit: got status %d", rec.Code)
+	}
+	// A token comes back every 30 seconds.
+	if got := rec.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("got Retry-After %q, want 30", got)
+	}
+	if got := rec.Header().Get("RateLimit-Remaining"); got != "0" {
+		t.Errorf("got RateLimit-Remaining %q, want 0", got)
+	}
+
+	// Another key and requests without a key aren't affected.
+	if rec := serve(handler, "b", ""); rec.Code != http.StatusOK {
+		t.Errorf("request of another key: got status %d", rec.Code)
+	}
+	if rec := serve(handler, "", ""); rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("request without a key: got status %d and headers %v", rec.Code, rec.Header())
+	}
+}
+
+func TestRateLimitFewestRemaining(t *testing.T) {
+	config.Envs = &config.AppEnvs{RATE_LIMIT_STORE: "memory"}
+	store := ratelimit.NewStore()
+	loose := rateLimit(store, "test_loose", &config.RateLimit{Limit: 10, Period: time.Minute}, byHeader)
+	strict := rateLimit(store, "test_strict", &config.RateLimit{Limit: 3, Period: time.Hour}, byHeader)
+
+	// The headers describe the stricter limit, whichever order the limits run in.
+	for i, handler := range []http.Handler{loose(strict(okHandler)), strict(loose(okHandler))} {
+		rec := serve(handler, strconv.Itoa(i), "")
+		if got := rec.Header().Get("RateLimit-Policy"); got != "3;w=3600" {
+			t.Errorf("got RateLimit-Policy %q, want the strict limit", got)
+		}
+	}
+}
+
+func TestRateLimitByEmail(t *testing.T) {
+	config.Envs = &config.AppEnvs{RATE_LIMIT_STORE: "memory"}
+	var body string
+	handler := rateLimit(ratelimit.NewStore(), "test_email", &config.RateLimit{Limit: 1, Period: time.Hour}, byEmail)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, err := io.ReadAll(r.Body)
+			if err != nil {
+				t.Error(err)
+			}
+			body = string(b)
+		}),
+	)
+
+	if rec := serve(handler, "", `{"email":"Jane@Example.com"}`); rec.Code != http.StatusOK {
+		t.Fatalf("got status %d", rec.Code)
+	}
+	if body != `{"email":"Jane@Example.com"}` {
+		t.Errorf("handler read body %q", body)
+	}
+	// The address is normalised, so changing its case doesn't get around the limit.
+	if rec := serve(handler, "", `{"email":" jane@example.com"}`); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("got status %d for the same address", rec.Code)
+	}
+}
+
+func TestRateLimitOff(t *testing.T) {
+	handler := rateLimit(failingStore{}, "test_off", nil, byHeader)(okHandler)
+	if rec := serve(handler, "a", ""); rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("got status %d and headers %v", rec.Code, rec.Header())
+	}
+}
+
+func TestRateLimitStoreDown(t *testing.T) {
+	handler := rateLimit(failingStore{}, "test_down", &config.RateLimit{Limit: 1, Period: time.Minute}, byHeader)(okHandler)
+	for i := 0; i < 3; i++ {
+		if rec := serve(handler, "a", ""); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: got status %d while the store is down", i+1, rec.Code)
+		}
+	}
+}
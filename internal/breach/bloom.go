@@ -0,0 +1,101 @@
+package breach
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// bloomMagic starts every bloom filter file, it tells filter files apart from hash lists.
+const bloomMagic = "BRCHBLM1"
+
+// bloomFilter is a bloom filter of SHA-1 hashes. As SHA-1 hashes are uniformly distributed already,
+// the bit positions are derived from the hash itself instead of hashing it again.
+type bloomFilter struct {
+	m    uint64
+	k    uint32
+	bits []uint64
+}
+
+// newBloomFilter returns an empty bloom filter sized for n hashes with the given false positive rate.
+func newBloomFilter(n uint64, falsePositiveRate float64) *bloomFilter {
+	if n == 0 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	k := uint32(math.Max(1, math.Round(float64(m)/float64(n)*math.Ln2)))
+	return &bloomFilter{m: m, k: k, bits: make([]uint64, (m+63)/64)}
+}
+
+// positions returns the k bit positions of a hash, using double hashing over the first 16 bytes.
+func (f *bloomFilter) positions(hash [20]byte, fn func(pos uint64) bool) bool {
+	h1 := binary.LittleEndian.Uint64(hash[0:8])
+	h2 := binary.LittleEndian.Uint64(hash[8:16]) | 1
+	for i := uint64(0); i < uint64(f.k); i++ {
+		if !fn((h1 + i*h2) % f.m) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *bloomFilter) add(hash [20]byte) {
+	f.positions(hash, func(pos uint64) bool {
+		f.bits[pos/64] |= 1 << (pos % 64)
+		return true
+	})
+}
+
+func (f *bloomFilter) contains(hash [20]byte) bool {
+	return f.positions(hash, func(pos uint64) bool {
+		return f.bits[pos/64]&(1<<(pos%64)) != 0
+	})
+}
+
+// writeFile stores the filter as the magic, m, k and the bits, all little endian.
+func (f *bloomFilter) writeFile(name string) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	w.WriteString(bloomMagic)
+	binary.Write(w, binary.LittleEndian, f.m)
+	binary.Write(w, binary.LittleEndian, f.k)
+	if err := binary.Write(w, binary.LittleEndian, f.bits); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// readBloomFilter reads a filter written by writeFile.
+func readBloomFilter(r io.Reader) (*bloomFilter, error) {
+	r = bufio.NewReader(r)
+	magic := make([]byte, len(bloomMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != bloomMagic {
+		return nil, fmt.Errorf("not a bloom filter file")
+	}
+	f := &bloomFilter{}
+	if err := binary.Read(r, binary.LittleEndian, &f.m); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &f.k); err != nil {
+		return nil, err
+	}
+	if f.m == 0 || f.k == 0 {
+		return nil, fmt.Errorf("invalid bloom filter header")
+	}
+	f.bits = make([]uint64, (f.m+63)/64)
+	if err := binary.Read(r, binary.LittleEndian, f.bits); err != nil {
+		return nil, fmt.Errorf("truncated bloom filter: %w", err)
+	}
+	return f, nil
+}
@@ -0,0 +1,120 @@
+package breach
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/config"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/utils"
+)
+
+var (
+	checkerOnce sync.Once
+	checker     BreachCheckerInterface
+)
+
+// BreachCheckerInterface reports whether a password appears in a corpus of breached passwords.
+type BreachCheckerInterface interface {
+	IsBreached(password string) bool
+}
+
+// NewBreachChecker returns the singleton checker loaded from BREACHED_PASSWORDS_FILE, which is either
+// a bloom filter built with the build-breach-filter command, a Pwned Passwords hash list, or a directory
+// of range files. Without BREACHED_PASSWORDS_FILE no password counts as breached.
+// If the file can't be loaded, it will panic.
+func NewBreachChecker() BreachCheckerInterface {
+	checkerOnce.Do(func() {
+		if config.Envs.BREACHED_PASSWORDS_FILE == "" {
+			checker = &NoopChecker{}
+			return
+		}
+		filter, err := loadFilter(config.Envs.BREACHED_PASSWORDS_FILE, config.Envs.BREACHED_PASSWORDS_MIN_COUNT, 0.001)
+		if err != nil {
+			utils.Log.Error("error loading breached passwords", "file", config.Envs.BREACHED_PASSWORDS_FILE, "error", err)
+			panic(err)
+		}
+		utils.Log.Info("breached passwords loaded", "file", config.Envs.BREACHED_PASSWORDS_FILE, "bits", filter.m)
+		checker = &BloomChecker{filter: filter}
+	})
+	return checker
+}
+
+// NoopChecker is used when no breach corpus is configured.
+type NoopChecker struct{}
+
+func (c *NoopChecker) IsBreached(password string) bool {
+	return false
+}
+
+// BloomChecker looks passwords up in a bloom filter of their SHA-1 hashes. A bloom filter has no false
+// negatives, a small share of the passwords which never leaked is rejected as well.
+type BloomChecker struct {
+	filter *bloomFilter
+}
+
+func (c *BloomChecker) IsBreached(password string) bool {
+	return c.filter.contains(sha1.Sum([]byte(password)))
+}
+
+// loadFilter loads a breach corpus into a bloom filter. A bloom filter file is read as is, hash lists
+// and range directories are read into a new filter with the given false positive rate, skipping hashes
+// seen fewer than minCount times.
+func loadFilter(name string, minCount int, falsePositiveRate float64) (*bloomFilter, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return buildFilter(func(fn func(hash [20]byte)) error {
+			return readRangeDir(name, minCount, fn)
+		}, falsePositiveRate)
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	magic := make([]byte, len(bloomMagic))
+	if n, _ := file.Read(magic); n == len(magic) && string(magic) == bloomMagic {
+		if _, err := file.Seek(0, 0); err != nil {
+			return nil, err
+		}
+		return readBloomFilter(file)
+	}
+
+	return buildFilter(func(fn func(hash [20]byte)) error {
+		if _, err := file.Seek(0, 0); err != nil {
+			return err
+		}
+		return readHashList(file, minCount, fn)
+	}, falsePositiveRate)
+}
+
+// buildFilter reads the hashes twice, first to size the filter and then to fill it,
+// so the corpus never has to fit into memory.
+func buildFilter(read func(fn func(hash [20]byte)) error, falsePositiveRate float64) (*bloomFilter, error) {
+	var n uint64
+	if err := read(func(hash [20]byte) { n++ }); err != nil {
+		return nil, err
+	}
+	filter := newBloomFilter(n, falsePositiveRate)
+	if err := read(filter.add); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// BuildFilterFile converts a hash list or range directory into a bloom filter file, which loads much faster.
+func BuildFilterFile(input string, output string, minCount int, falsePositiveRate float64) error {
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		return fmt.Errorf("the false positive rate must be between 0 and 1")
+	}
+	filter, err := loadFilter(input, minCount, falsePositiveRate)
+	if err != nil {
+		return err
+	}
+	return filter.writeFile(output)
+}
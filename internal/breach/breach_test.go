@@ -0,0 +1,141 @@
+package breach
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sha1Hex returns the uppercase hex SHA-1 of a password, as in the Pwned Passwords corpus.
+func sha1Hex(password string) string {
+	hash := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(hash[:]))
+}
+
+func TestBloomFilter(t *testing.T) {
+	filter := newBloomFilter(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		filter.add(sha1.Sum([]byte(fmt.Sprintf("breached-%d", i))))
+	}
+	for i := 0; i < 1000; i++ {
+		if !filter.contains(sha1.Sum([]byte(fmt.Sprintf("breached-%d", i)))) {
+			t.Fatalf("added hash %d is missing", i)
+		}
+	}
+
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if filter.contains(sha1.Sum([]byte(fmt.Sprintf("safe-%d", i)))) {
+			falsePositives++
+		}
+	}
+	// 1% of 10000 is expected, allow for some variance.
+	if falsePositives > 200 {
+		t.Errorf("got %d false positives out of 10000", falsePositives)
+	}
+}
+
+func TestBloomFilterFile(t *testing.T) {
+	filter := newBloomFilter(10, 0.001)
+	filter.add(sha1.Sum([]byte("password")))
+	name := filepath.Join(t.TempDir(), "breached.bloom")
+	if err := filter.writeFile(name); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadFilter(name, 1, 0.001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.m != filter.m || loaded.k != filter.k {
+		t.Fatalf("got m=%d k=%d, want m=%d k=%d", loaded.m, loaded.k, filter.m, filter.k)
+	}
+	if !loaded.contains(sha1.Sum([]byte("password"))) {
+		t.Error("loaded filter is missing the hash")
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readBloomFilter(strings.NewReader(string(data[:len(data)-1]))); err == nil {
+		t.Error("truncated filter file was read")
+	}
+}
+
+func TestLoadHashList(t *testing.T) {
+	corpus := strings.Join([]string{
+		sha1Hex("password") + ":3861493",
+		sha1Hex("rarely-used") + ":1",
+		"",
+		strings.ToLower(sha1Hex("lowercase-hex")) + ":42",
+	}, "\n")
+	name := filepath.Join(t.TempDir(), "pwned.txt")
+	if err := os.WriteFile(name, []byte(corpus), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	checker := func(minCount int) *BloomChecker {
+		filter, err := loadFilter(name, minCount, 0.0001)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &BloomChecker{filter: filter}
+	}
+	all := checker(1)
+	for _, password := range []string{"password", "rarely-used", "lowercase-hex"} {
+		if !all.IsBreached(password) {
+			t.Errorf("%q isn't breached", password)
+		}
+	}
+	if all.IsBreached("correct horse battery staple") {
+		t.Error("a password missing from the corpus is breached")
+	}
+	if checker(2).IsBreached("rarely-used") {
+		t.Error("a password seen fewer than the minimum count is breached")
+	}
+}
+
+func TestLoadRangeDir(t *testing.T) {
+	dir := t.TempDir()
+	hash := sha1Hex("password")
+	if err := os.WriteFile(filepath.Join(dir, hash[:5]+".txt"), []byte(hash[5:]+":3861493\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// Files which aren't range files are skipped.
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a range file"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	filter, err := loadFilter(dir, 1, 0.0001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker := &BloomChecker{filter: filter}
+	if !checker.IsBreached("password") {
+		t.Error("password of a range file isn't breached")
+	}
+	if checker.IsBreached("correct horse battery staple") {
+		t.Error("a password missing from the corpus is breached")
+	}
+}
+
+func TestScanHashesInvalid(t *testing.T) {
+	tests := []struct {
+		corpus   string
+		minCount int
+	}{
+		{corpus: "not-a-hash:1", minCount: 1},
+		{corpus: sha1Hex("password")[:39] + ":1", minCount: 1},
+		{corpus: sha1Hex("password") + ":many", minCount: 2},
+	}
+	for _, tt := range tests {
+		if err := scanHashes(strings.NewReader(tt.corpus), "", tt.minCount, func(hash [20]byte) {}); err == nil {
+			t.Errorf("corpus %q was read", tt.corpus)
+		}
+	}
+}
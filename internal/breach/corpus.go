@@ -0,0 +1,82 @@
+package breach
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// readHashList calls fn for every hash in a file in the format of the Pwned Passwords downloads,
+// one "<40 hex SHA-1>:<count>" per line, which was seen at least minCount times.
+func readHashList(r io.Reader, minCount int, fn func(hash [20]byte)) error {
+	return scanHashes(r, "", minCount, fn)
+}
+
+// readRangeDir calls fn for every hash in a directory of range files, named "<5 hex prefix>.txt" and holding
+// "<35 hex suffix>:<count>" lines like the responses of the Pwned Passwords range API.
+func readRangeDir(dir string, minCount int, fn func(hash [20]byte)) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		prefix, ok := rangePrefix(entry.Name())
+		if !ok || entry.IsDir() {
+			continue
+		}
+		file, err := os.Open(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		err = scanHashes(file, prefix, minCount, fn)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
+
+// rangePrefix returns the uppercase hash prefix of a range file name.
+func rangePrefix(name string) (string, bool) {
+	prefix, ok := strings.CutSuffix(name, ".txt")
+	if !ok || len(prefix) != 5 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(prefix + "0"); err != nil {
+		return "", false
+	}
+	return strings.ToUpper(prefix), true
+}
+
+// scanHashes parses "<hex>:<count>" lines, prefix is put in front of every hex value.
+func scanHashes(r io.Reader, prefix string, minCount int, fn func(hash [20]byte)) error {
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		value, countText, _ := strings.Cut(text, ":")
+		if countText != "" && minCount > 1 {
+			count, err := strconv.Atoi(countText)
+			if err != nil {
+				return fmt.Errorf("line %d: invalid count", line)
+			}
+			if count < minCount {
+				continue
+			}
+		}
+		var hash [20]byte
+		if n, err := hex.Decode(hash[:], []byte(prefix+value)); err != nil || n != len(hash) {
+			return fmt.Errorf("line %d: invalid SHA-1 hash", line)
+		}
+		fn(hash)
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,32 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// ValidateIssuerAndAudience checks that a token was issued by JWT_ISSUER and that its audience
+// contains at least one of the JWT_AUDIENCE values, so tokens meant for other apps are refused.
+func ValidateIssuerAndAudience(token jwt.Token) error {
+	if token.Issuer() != Envs.JWT_ISSUER {
+		return fmt.Errorf("invalid token issuer")
+	}
+	for _, aud := range token.Audience() {
+		if slices.Contains(Envs.JWT_AUDIENCE, aud) {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid token audience")
+}
+
+// ValidateTokenType checks that the typ claim of a token is tokenType, so e.g. a refresh
+// token can't be used as an access token.
+func ValidateTokenType(token jwt.Token, tokenType string) error {
+	typ, _ := token.Get("typ")
+	if typ != tokenType {
+		return fmt.Errorf("invalid token type")
+	}
+	return nil
+}
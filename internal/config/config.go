@@ -4,7 +4,7 @@ import (
 	"database/sql"
 	"sync"
 
-	"github.com/go-chi/jwtauth/v5"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/utils"
 )
 
 var (
@@ -14,18 +14,26 @@ var (
 
 type AppConfig struct {
 	DB      *sql.DB
-	JWTAuth *jwtauth.JWTAuth
+	KeyRing *KeyRing
 }
 
 // NewAppConfig initializes and returns a singleton instance of AppConfig.
 // It ensures that the configuration is loaded only once using sync.Once.
-// This function sets up the JWT authentication client and the database client.
-// If there is an error initializing the database client, it will panic.
+// This function sets up the JWT key ring and the database client.
+// If there is an error initializing the JWT key ring or the database client, it will panic.
 // Wherever you need any config variables, use this function call directly as it's a singleton.
 func NewAppConfig() *AppConfig {
 	once.Do(func() {
+		keyRing, err := newKeyRing()
+		if err != nil {
+			utils.Log.Error("error creating jwt key ring", "error", err)
+			panic(err)
+		}
+		if Envs.JWT_KEYS_DIR != "" {
+			keyRing.watch()
+		}
 		appConfig = &AppConfig{
-			JWTAuth: newJWTAuthClient(),
+			KeyRing: keyRing,
 		}
 		db, err := newDBClient()
 		if err != nil {
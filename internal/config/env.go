@@ -1,10 +1,15 @@
 package config
 
 import (
+	"encoding/base64"
 	"fmt"
+	"log/slog"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/the-arcade-01/golang-jwt-authentication/internal/utils"
 )
@@ -16,18 +21,104 @@ var (
 
 // AppEnvs holds the environment variables for the application.
 type AppEnvs struct {
-	ENV                       string
-	WEB_URL                   string
-	JWT_SECRET_KEY            string
-	DB_DRIVER                 string
-	DB_URL                    string
-	DB_MAX_IDLE_CONN          int
-	DB_MAX_OPEN_CONN          int
-	DB_MAX_CONN_TIME_SEC      int
-	HTTP_COOKIE_HTTPONLY      bool
-	HTTP_COOKIE_SECURE        bool
-	HTTP_ACCESS_TOKEN_EXPIRE  int
-	HTTP_REFRESH_TOKEN_EXPIRE int
+	ENV                           string
+	WEB_URL                       string
+	JWT_ALGORITHM                 string
+	JWT_SECRET_KEY                string
+	JWT_PRIVATE_KEY_FILE          string
+	JWT_PREVIOUS_PUBLIC_KEY_FILES string
+	JWT_ISSUER                    string
+	JWT_AUDIENCE                  []string
+	JWT_KEYS_DIR                  string
+	JWT_KEYS_GRACE_PERIOD         int
+	JWT_KEYS_RELOAD_INTERVAL_SEC  int
+	TOKEN_HASH_PEPPER             string
+	REVOCATION_STORE              string
+	ATTEMPT_STORE                 string
+	RATE_LIMIT_STORE              string
+	RATE_LIMIT_LOGIN_IP           *RateLimit
+	RATE_LIMIT_LOGIN_EMAIL        *RateLimit
+	RATE_LIMIT_SIGNUP_IP          *RateLimit
+	RATE_LIMIT_REFRESH_IP         *RateLimit
+	RATE_LIMIT_EMAIL_IP           *RateLimit
+	RATE_LIMIT_USER               *RateLimit
+	REAL_IP_HEADER                string
+	ADMIN_API_KEY                 string
+	INTROSPECTION_CLIENTS         map[string]string
+	MAILER                        string
+	MAILER_FROM                   string
+	MAILER_FILE_DIR               string
+	SMTP_HOST                     string
+	SMTP_PORT                     string
+	SMTP_USERNAME                 string
+	SMTP_PASSWORD                 string
+	REQUIRE_EMAIL_VERIFICATION    bool
+	EMAIL_VERIFICATION_EXPIRE     int
+	PASSWORD_RESET_EXPIRE         int
+	PASSWORD_RESET_MAX_PER_HOUR   int
+	EMAIL_CHANGE_EXPIRE           int
+	MAGIC_LINK_EXPIRE             int
+	MAGIC_LINK_MAX_PER_HOUR       int
+	EMAIL_OTP_EXPIRE              int
+	EMAIL_OTP_MAX_PER_HOUR        int
+	EMAIL_OTP_MAX_ATTEMPTS        int
+	PASSWORD_HASHER               string
+	BCRYPT_COST                   int
+	ARGON2_TIME                   int
+	ARGON2_MEMORY                 int
+	ARGON2_THREADS                int
+	PASSWORD_MIN_LENGTH           int
+	PASSWORD_MAX_LENGTH           int
+	PASSWORD_REQUIRED_CLASSES     []string
+	PASSWORD_BANNED_FILE          string
+	BREACHED_PASSWORDS_FILE       string
+	BREACHED_PASSWORDS_MIN_COUNT  int
+	LOGIN_FAILURE_WINDOW          int
+	LOGIN_BACKOFF_AFTER           int
+	LOGIN_BACKOFF_BASE_SEC        int
+	LOGIN_BACKOFF_MAX_SEC         int
+	LOGIN_LOCKOUT_THRESHOLD       int
+	LOGIN_LOCKOUT_DURATION        int
+	LOGIN_IP_LOCKOUT_THRESHOLD    int
+	MFA_ENCRYPTION_KEY            []byte
+	MFA_ISSUER                    string
+	MFA_PENDING_EXPIRE            int
+	WEBAUTHN_RP_ID                string
+	WEBAUTHN_RP_NAME              string
+	WEBAUTHN_ORIGINS              []string
+	WEBAUTHN_CHALLENGE_EXPIRE     int
+	DB_DRIVER                     string
+	DB_URL                        string
+	DB_MAX_IDLE_CONN              int
+	DB_MAX_OPEN_CONN              int
+	DB_MAX_CONN_TIME_SEC          int
+	HTTP_COOKIE_HTTPONLY          bool
+	HTTP_COOKIE_SECURE            bool
+	HTTP_ACCESS_TOKEN_EXPIRE      int
+	HTTP_REFRESH_TOKEN_EXPIRE     int
+}
+
+// redacted replaces secret values when the envs are logged.
+const redacted = "[REDACTED]"
+
+// LogValue implements slog.LogValuer, so logging the envs never writes keys, passwords or
+// credentials to the log. Secrets which are set are replaced by a placeholder,
+// the binary MFA key is left out.
+func (e *AppEnvs) LogValue() slog.Value {
+	// appEnvs has the fields of AppEnvs, but not this method, which would otherwise be called again.
+	type appEnvs AppEnvs
+	envs := appEnvs(*e)
+	for _, secret := range []*string{&envs.JWT_SECRET_KEY, &envs.TOKEN_HASH_PEPPER, &envs.ADMIN_API_KEY, &envs.SMTP_PASSWORD, &envs.DB_URL} {
+		if *secret != "" {
+			*secret = redacted
+		}
+	}
+	envs.MFA_ENCRYPTION_KEY = nil
+	envs.INTROSPECTION_CLIENTS = make(map[string]string, len(e.INTROSPECTION_CLIENTS))
+	for clientID := range e.INTROSPECTION_CLIENTS {
+		envs.INTROSPECTION_CLIENTS[clientID] = redacted
+	}
+	return slog.AnyValue(envs)
 }
 
 // ParseEnvs parses the environment variables and stores them in the AppEnvs struct.
@@ -39,18 +130,371 @@ func ParseEnvs() (*AppEnvs, error) {
 	var err error
 	envOnce.Do(func() {
 		Envs = &AppEnvs{
-			ENV:            os.Getenv("ENV"),
-			WEB_URL:        os.Getenv("WEB_URL"),
-			JWT_SECRET_KEY: os.Getenv("JWT_SECRET_KEY"),
-			DB_DRIVER:      os.Getenv("DB_DRIVER"),
-			DB_URL:         os.Getenv("DB_URL"),
+			ENV:                           os.Getenv("ENV"),
+			WEB_URL:                       os.Getenv("WEB_URL"),
+			JWT_ALGORITHM:                 os.Getenv("JWT_ALGORITHM"),
+			JWT_SECRET_KEY:                os.Getenv("JWT_SECRET_KEY"),
+			JWT_PRIVATE_KEY_FILE:          os.Getenv("JWT_PRIVATE_KEY_FILE"),
+			JWT_PREVIOUS_PUBLIC_KEY_FILES: os.Getenv("JWT_PREVIOUS_PUBLIC_KEY_FILES"),
+			JWT_ISSUER:                    os.Getenv("JWT_ISSUER"),
+			JWT_KEYS_DIR:                  os.Getenv("JWT_KEYS_DIR"),
+			TOKEN_HASH_PEPPER:             os.Getenv("TOKEN_HASH_PEPPER"),
+			REVOCATION_STORE:              os.Getenv("REVOCATION_STORE"),
+			ATTEMPT_STORE:                 os.Getenv("ATTEMPT_STORE"),
+			RATE_LIMIT_STORE:              os.Getenv("RATE_LIMIT_STORE"),
+			REAL_IP_HEADER:                os.Getenv("REAL_IP_HEADER"),
+			ADMIN_API_KEY:                 os.Getenv("ADMIN_API_KEY"),
+			MAILER:                        os.Getenv("MAILER"),
+			MAILER_FROM:                   os.Getenv("MAILER_FROM"),
+			MAILER_FILE_DIR:               os.Getenv("MAILER_FILE_DIR"),
+			SMTP_HOST:                     os.Getenv("SMTP_HOST"),
+			SMTP_PORT:                     os.Getenv("SMTP_PORT"),
+			SMTP_USERNAME:                 os.Getenv("SMTP_USERNAME"),
+			SMTP_PASSWORD:                 os.Getenv("SMTP_PASSWORD"),
+			PASSWORD_HASHER:               os.Getenv("PASSWORD_HASHER"),
+			PASSWORD_BANNED_FILE:          os.Getenv("PASSWORD_BANNED_FILE"),
+			BREACHED_PASSWORDS_FILE:       os.Getenv("BREACHED_PASSWORDS_FILE"),
+			MFA_ISSUER:                    os.Getenv("MFA_ISSUER"),
+			WEBAUTHN_RP_ID:                os.Getenv("WEBAUTHN_RP_ID"),
+			WEBAUTHN_RP_NAME:              os.Getenv("WEBAUTHN_RP_NAME"),
+			DB_DRIVER:                     os.Getenv("DB_DRIVER"),
+			DB_URL:                        os.Getenv("DB_URL"),
 		}
 
-		if Envs.ENV == "" || Envs.WEB_URL == "" || Envs.JWT_SECRET_KEY == "" || Envs.DB_DRIVER == "" || Envs.DB_URL == "" {
+		if Envs.ENV == "" || Envs.WEB_URL == "" || Envs.TOKEN_HASH_PEPPER == "" || Envs.DB_DRIVER == "" || Envs.DB_URL == "" {
 			err = fmt.Errorf("invalid env variables in .env file, please check")
 			return
 		}
 
+		if Envs.REVOCATION_STORE == "" {
+			Envs.REVOCATION_STORE = "memory"
+		}
+		if Envs.REVOCATION_STORE != "memory" && Envs.REVOCATION_STORE != "db" {
+			err = fmt.Errorf("invalid REVOCATION_STORE value")
+			return
+		}
+
+		if Envs.ATTEMPT_STORE == "" {
+			Envs.ATTEMPT_STORE = "memory"
+		}
+		if Envs.ATTEMPT_STORE != "memory" && Envs.ATTEMPT_STORE != "db" {
+			err = fmt.Errorf("invalid ATTEMPT_STORE value")
+			return
+		}
+
+		if Envs.RATE_LIMIT_STORE == "" {
+			Envs.RATE_LIMIT_STORE = "memory"
+		}
+		if Envs.RATE_LIMIT_STORE != "memory" && Envs.RATE_LIMIT_STORE != "db" {
+			err = fmt.Errorf("invalid RATE_LIMIT_STORE value")
+			return
+		}
+
+		rateLimits := []struct {
+			limit **RateLimit
+			name  string
+			def   string
+		}{
+			{&Envs.RATE_LIMIT_LOGIN_IP, "RATE_LIMIT_LOGIN_IP", "20/1m"},
+			{&Envs.RATE_LIMIT_LOGIN_EMAIL, "RATE_LIMIT_LOGIN_EMAIL", "10/1m"},
+			{&Envs.RATE_LIMIT_SIGNUP_IP, "RATE_LIMIT_SIGNUP_IP", "10/1h"},
+			{&Envs.RATE_LIMIT_REFRESH_IP, "RATE_LIMIT_REFRESH_IP", "60/1m"},
+			{&Envs.RATE_LIMIT_EMAIL_IP, "RATE_LIMIT_EMAIL_IP", "10/1h"},
+			{&Envs.RATE_LIMIT_USER, "RATE_LIMIT_USER", "300/1m"},
+		}
+		for _, rateLimit := range rateLimits {
+			*rateLimit.limit, err = optionalRateLimit(rateLimit.name, rateLimit.def)
+			if err != nil {
+				err = fmt.Errorf("invalid %s value, it must look like 10/1m or be off", rateLimit.name)
+				return
+			}
+		}
+
+		// The log and file mailers don't deliver anything, so outside of development
+		// a missing MAILER fails the startup instead of silently dropping every email.
+		if Envs.MAILER == "" && Envs.ENV == "development" {
+			Envs.MAILER = "log"
+		}
+		if Envs.MAILER == "" {
+			err = fmt.Errorf("MAILER is required")
+			return
+		}
+		if Envs.MAILER != "log" && Envs.MAILER != "file" && Envs.MAILER != "smtp" {
+			err = fmt.Errorf("invalid MAILER value")
+			return
+		}
+		if Envs.MAILER != "smtp" && Envs.ENV != "development" {
+			err = fmt.Errorf("the %s mailer is only allowed when ENV is development", Envs.MAILER)
+			return
+		}
+		if Envs.MAILER == "file" && Envs.MAILER_FILE_DIR == "" {
+			err = fmt.Errorf("MAILER_FILE_DIR is required for the file mailer")
+			return
+		}
+		if Envs.MAILER == "smtp" && (Envs.SMTP_HOST == "" || Envs.SMTP_PORT == "" || Envs.MAILER_FROM == "") {
+			err = fmt.Errorf("SMTP_HOST, SMTP_PORT and MAILER_FROM are required for the smtp mailer")
+			return
+		}
+		if Envs.MAILER_FROM == "" {
+			Envs.MAILER_FROM = "no-reply@localhost"
+		}
+
+		Envs.REQUIRE_EMAIL_VERIFICATION, err = optionalBool("REQUIRE_EMAIL_VERIFICATION", false)
+		if err != nil {
+			err = fmt.Errorf("invalid REQUIRE_EMAIL_VERIFICATION value")
+			return
+		}
+
+		Envs.EMAIL_VERIFICATION_EXPIRE, err = optionalInt("EMAIL_VERIFICATION_EXPIRE", 24*60)
+		if err != nil || Envs.EMAIL_VERIFICATION_EXPIRE <= 0 {
+			err = fmt.Errorf("invalid EMAIL_VERIFICATION_EXPIRE value")
+			return
+		}
+
+		Envs.PASSWORD_RESET_EXPIRE, err = optionalInt("PASSWORD_RESET_EXPIRE", 30)
+		if err != nil || Envs.PASSWORD_RESET_EXPIRE <= 0 {
+			err = fmt.Errorf("invalid PASSWORD_RESET_EXPIRE value")
+			return
+		}
+
+		Envs.PASSWORD_RESET_MAX_PER_HOUR, err = optionalInt("PASSWORD_RESET_MAX_PER_HOUR", 3)
+		if err != nil || Envs.PASSWORD_RESET_MAX_PER_HOUR <= 0 {
+			err = fmt.Errorf("invalid PASSWORD_RESET_MAX_PER_HOUR value")
+			return
+		}
+
+		Envs.EMAIL_CHANGE_EXPIRE, err = optionalInt("EMAIL_CHANGE_EXPIRE", 60)
+		if err != nil || Envs.EMAIL_CHANGE_EXPIRE <= 0 {
+			err = fmt.Errorf("invalid EMAIL_CHANGE_EXPIRE value")
+			return
+		}
+
+		Envs.MAGIC_LINK_EXPIRE, err = optionalInt("MAGIC_LINK_EXPIRE", 15)
+		if err != nil || Envs.MAGIC_LINK_EXPIRE <= 0 {
+			err = fmt.Errorf("invalid MAGIC_LINK_EXPIRE value")
+			return
+		}
+
+		Envs.MAGIC_LINK_MAX_PER_HOUR, err = optionalInt("MAGIC_LINK_MAX_PER_HOUR", 5)
+		if err != nil || Envs.MAGIC_LINK_MAX_PER_HOUR <= 0 {
+			err = fmt.Errorf("invalid MAGIC_LINK_MAX_PER_HOUR value")
+			return
+		}
+
+		Envs.EMAIL_OTP_EXPIRE, err = optionalInt("EMAIL_OTP_EXPIRE", 5)
+		if err != nil || Envs.EMAIL_OTP_EXPIRE <= 0 {
+			err = fmt.Errorf("invalid EMAIL_OTP_EXPIRE value")
+			return
+		}
+
+		Envs.EMAIL_OTP_MAX_PER_HOUR, err = optionalInt("EMAIL_OTP_MAX_PER_HOUR", 5)
+		if err != nil || Envs.EMAIL_OTP_MAX_PER_HOUR <= 0 {
+			err = fmt.Errorf("invalid EMAIL_OTP_MAX_PER_HOUR value")
+			return
+		}
+
+		Envs.EMAIL_OTP_MAX_ATTEMPTS, err = optionalInt("EMAIL_OTP_MAX_ATTEMPTS", 5)
+		if err != nil || Envs.EMAIL_OTP_MAX_ATTEMPTS <= 0 {
+			err = fmt.Errorf("invalid EMAIL_OTP_MAX_ATTEMPTS value")
+			return
+		}
+
+		if Envs.PASSWORD_HASHER == "" {
+			Envs.PASSWORD_HASHER = "argon2id"
+		}
+		if Envs.PASSWORD_HASHER != "argon2id" && Envs.PASSWORD_HASHER != "bcrypt" {
+			err = fmt.Errorf("invalid PASSWORD_HASHER value")
+			return
+		}
+
+		Envs.BCRYPT_COST, err = optionalInt("BCRYPT_COST", 10)
+		if err != nil || Envs.BCRYPT_COST < 4 || Envs.BCRYPT_COST > 31 {
+			err = fmt.Errorf("invalid BCRYPT_COST value, it must be between 4 and 31")
+			return
+		}
+
+		Envs.ARGON2_TIME, err = optionalInt("ARGON2_TIME", 3)
+		if err != nil || Envs.ARGON2_TIME <= 0 {
+			err = fmt.Errorf("invalid ARGON2_TIME value")
+			return
+		}
+
+		Envs.ARGON2_MEMORY, err = optionalInt("ARGON2_MEMORY", 64*1024)
+		if err != nil || Envs.ARGON2_MEMORY < 8*1024 {
+			err = fmt.Errorf("invalid ARGON2_MEMORY value, it must be at least 8192 KiB")
+			return
+		}
+
+		Envs.ARGON2_THREADS, err = optionalInt("ARGON2_THREADS", 2)
+		if err != nil || Envs.ARGON2_THREADS <= 0 || Envs.ARGON2_THREADS > 255 {
+			err = fmt.Errorf("invalid ARGON2_THREADS value")
+			return
+		}
+
+		Envs.PASSWORD_MIN_LENGTH, err = optionalInt("PASSWORD_MIN_LENGTH", 8)
+		if err != nil || Envs.PASSWORD_MIN_LENGTH <= 0 {
+			err = fmt.Errorf("invalid PASSWORD_MIN_LENGTH value")
+			return
+		}
+
+		// bcrypt only uses the first 72 bytes of a password, Argon2id takes any length,
+		// but hashing very long passwords only costs time.
+		maxPasswordLength := 256
+		if Envs.PASSWORD_HASHER == "bcrypt" {
+			maxPasswordLength = 72
+		}
+		Envs.PASSWORD_MAX_LENGTH, err = optionalInt("PASSWORD_MAX_LENGTH", maxPasswordLength)
+		if err != nil || Envs.PASSWORD_MAX_LENGTH < Envs.PASSWORD_MIN_LENGTH || Envs.PASSWORD_MAX_LENGTH > maxPasswordLength {
+			err = fmt.Errorf("invalid PASSWORD_MAX_LENGTH value, it must be between PASSWORD_MIN_LENGTH and %d", maxPasswordLength)
+			return
+		}
+
+		for _, class := range strings.Split(os.Getenv("PASSWORD_REQUIRED_CLASSES"), ",") {
+			if class = strings.TrimSpace(class); class == "" {
+				continue
+			}
+			if class != "lower" && class != "upper" && class != "digit" && class != "symbol" {
+				err = fmt.Errorf("invalid PASSWORD_REQUIRED_CLASSES value %q", class)
+				return
+			}
+			Envs.PASSWORD_REQUIRED_CLASSES = append(Envs.PASSWORD_REQUIRED_CLASSES, class)
+		}
+
+		Envs.BREACHED_PASSWORDS_MIN_COUNT, err = optionalInt("BREACHED_PASSWORDS_MIN_COUNT", 1)
+		if err != nil || Envs.BREACHED_PASSWORDS_MIN_COUNT <= 0 {
+			err = fmt.Errorf("invalid BREACHED_PASSWORDS_MIN_COUNT value")
+			return
+		}
+
+		Envs.LOGIN_FAILURE_WINDOW, err = optionalInt("LOGIN_FAILURE_WINDOW", 60)
+		if err != nil || Envs.LOGIN_FAILURE_WINDOW <= 0 {
+			err = fmt.Errorf("invalid LOGIN_FAILURE_WINDOW value")
+			return
+		}
+
+		Envs.LOGIN_BACKOFF_AFTER, err = optionalInt("LOGIN_BACKOFF_AFTER", 3)
+		if err != nil || Envs.LOGIN_BACKOFF_AFTER < 0 {
+			err = fmt.Errorf("invalid LOGIN_BACKOFF_AFTER value")
+			return
+		}
+
+		Envs.LOGIN_BACKOFF_BASE_SEC, err = optionalInt("LOGIN_BACKOFF_BASE_SEC", 1)
+		if err != nil || Envs.LOGIN_BACKOFF_BASE_SEC <= 0 {
+			err = fmt.Errorf("invalid LOGIN_BACKOFF_BASE_SEC value")
+			return
+		}
+
+		Envs.LOGIN_BACKOFF_MAX_SEC, err = optionalInt("LOGIN_BACKOFF_MAX_SEC", 60)
+		if err != nil || Envs.LOGIN_BACKOFF_MAX_SEC < Envs.LOGIN_BACKOFF_BASE_SEC {
+			err = fmt.Errorf("invalid LOGIN_BACKOFF_MAX_SEC value")
+			return
+		}
+
+		// 0 disables the lockout, leaving only the backoff delays.
+		Envs.LOGIN_LOCKOUT_THRESHOLD, err = optionalInt("LOGIN_LOCKOUT_THRESHOLD", 10)
+		if err != nil || Envs.LOGIN_LOCKOUT_THRESHOLD < 0 {
+			err = fmt.Errorf("invalid LOGIN_LOCKOUT_THRESHOLD value")
+			return
+		}
+
+		Envs.LOGIN_LOCKOUT_DURATION, err = optionalInt("LOGIN_LOCKOUT_DURATION", 15)
+		if err != nil || Envs.LOGIN_LOCKOUT_DURATION <= 0 {
+			err = fmt.Errorf("invalid LOGIN_LOCKOUT_DURATION value")
+			return
+		}
+
+		Envs.LOGIN_IP_LOCKOUT_THRESHOLD, err = optionalInt("LOGIN_IP_LOCKOUT_THRESHOLD", 100)
+		if err != nil || Envs.LOGIN_IP_LOCKOUT_THRESHOLD < 0 {
+			err = fmt.Errorf("invalid LOGIN_IP_LOCKOUT_THRESHOLD value")
+			return
+		}
+
+		// Two-factor authentication is only offered when the key encrypting the TOTP secrets is set.
+		if mfaKey := os.Getenv("MFA_ENCRYPTION_KEY"); mfaKey != "" {
+			Envs.MFA_ENCRYPTION_KEY, err = base64.StdEncoding.DecodeString(mfaKey)
+			if err != nil || len(Envs.MFA_ENCRYPTION_KEY) != 32 {
+				err = fmt.Errorf("invalid MFA_ENCRYPTION_KEY value, it must be 32 base64 encoded bytes")
+				return
+			}
+		}
+		if Envs.MFA_ISSUER == "" {
+			Envs.MFA_ISSUER = "golang-jwt-authentication"
+		}
+
+		Envs.MFA_PENDING_EXPIRE, err = optionalInt("MFA_PENDING_EXPIRE", 5)
+		if err != nil || Envs.MFA_PENDING_EXPIRE <= 0 {
+			err = fmt.Errorf("invalid MFA_PENDING_EXPIRE value")
+			return
+		}
+
+		// Passkeys are bound to a domain, by default the one of the web app, which is also the only origin allowed.
+		if Envs.WEBAUTHN_RP_ID == "" {
+			webURL, parseErr := url.Parse(Envs.WEB_URL)
+			if parseErr != nil || webURL.Hostname() == "" {
+				err = fmt.Errorf("WEBAUTHN_RP_ID is required when WEB_URL has no host")
+				return
+			}
+			Envs.WEBAUTHN_RP_ID = webURL.Hostname()
+		}
+		if Envs.WEBAUTHN_RP_NAME == "" {
+			Envs.WEBAUTHN_RP_NAME = Envs.MFA_ISSUER
+		}
+		for _, origin := range strings.Split(os.Getenv("WEBAUTHN_ORIGINS"), ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				Envs.WEBAUTHN_ORIGINS = append(Envs.WEBAUTHN_ORIGINS, strings.TrimSuffix(origin, "/"))
+			}
+		}
+		if len(Envs.WEBAUTHN_ORIGINS) == 0 {
+			Envs.WEBAUTHN_ORIGINS = []string{strings.TrimSuffix(Envs.WEB_URL, "/")}
+		}
+
+		Envs.WEBAUTHN_CHALLENGE_EXPIRE, err = optionalInt("WEBAUTHN_CHALLENGE_EXPIRE", 5)
+		if err != nil || Envs.WEBAUTHN_CHALLENGE_EXPIRE <= 0 {
+			err = fmt.Errorf("invalid WEBAUTHN_CHALLENGE_EXPIRE value")
+			return
+		}
+
+		Envs.INTROSPECTION_CLIENTS = map[string]string{}
+		for _, client := range strings.Split(os.Getenv("INTROSPECTION_CLIENTS"), ",") {
+			if client = strings.TrimSpace(client); client == "" {
+				continue
+			}
+			clientID, clientSecret, ok := strings.Cut(client, ":")
+			if !ok || clientID == "" || clientSecret == "" {
+				err = fmt.Errorf("invalid INTROSPECTION_CLIENTS value")
+				return
+			}
+			Envs.INTROSPECTION_CLIENTS[clientID] = clientSecret
+		}
+
+		if Envs.JWT_ALGORITHM == "" {
+			Envs.JWT_ALGORITHM = "HS256"
+		}
+		if !isSupportedAlgorithm(Envs.JWT_ALGORITHM) {
+			err = fmt.Errorf("invalid JWT_ALGORITHM value")
+			return
+		}
+		if Envs.JWT_ISSUER == "" {
+			Envs.JWT_ISSUER = "http://localhost:8080"
+		}
+		Envs.JWT_ISSUER = strings.TrimSuffix(Envs.JWT_ISSUER, "/")
+		for _, aud := range strings.Split(os.Getenv("JWT_AUDIENCE"), ",") {
+			if aud = strings.TrimSpace(aud); aud != "" {
+				Envs.JWT_AUDIENCE = append(Envs.JWT_AUDIENCE, aud)
+			}
+		}
+		if len(Envs.JWT_AUDIENCE) == 0 {
+			Envs.JWT_AUDIENCE = []string{Envs.JWT_ISSUER}
+		}
+		if isHMACAlgorithm(Envs.JWT_ALGORITHM) && Envs.JWT_SECRET_KEY == "" && Envs.JWT_KEYS_DIR == "" {
+			err = fmt.Errorf("JWT_SECRET_KEY is required for %s", Envs.JWT_ALGORITHM)
+			return
+		}
+		if !isHMACAlgorithm(Envs.JWT_ALGORITHM) && Envs.JWT_PRIVATE_KEY_FILE == "" && Envs.JWT_KEYS_DIR == "" {
+			err = fmt.Errorf("JWT_PRIVATE_KEY_FILE is required for %s", Envs.JWT_ALGORITHM)
+			return
+		}
+
 		Envs.DB_MAX_IDLE_CONN, err = stringToInt(os.Getenv("DB_MAX_IDLE_CONN"))
 		if err != nil || Envs.DB_MAX_IDLE_CONN <= 0 {
 			err = fmt.Errorf("invalid DB_MAX_IDLE_CONN value")
@@ -100,6 +544,18 @@ func ParseEnvs() (*AppEnvs, error) {
 			return
 		}
 		Envs.HTTP_ACCESS_TOKEN_EXPIRE = httpAccessTokenExpire
+
+		Envs.JWT_KEYS_GRACE_PERIOD, err = optionalInt("JWT_KEYS_GRACE_PERIOD", Envs.HTTP_REFRESH_TOKEN_EXPIRE)
+		if err != nil || Envs.JWT_KEYS_GRACE_PERIOD < 0 {
+			err = fmt.Errorf("invalid JWT_KEYS_GRACE_PERIOD value")
+			return
+		}
+
+		Envs.JWT_KEYS_RELOAD_INTERVAL_SEC, err = optionalInt("JWT_KEYS_RELOAD_INTERVAL_SEC", 60)
+		if err != nil || Envs.JWT_KEYS_RELOAD_INTERVAL_SEC <= 0 {
+			err = fmt.Errorf("invalid JWT_KEYS_RELOAD_INTERVAL_SEC value")
+			return
+		}
 	})
 	if err != nil {
 		return nil, err
@@ -121,3 +577,54 @@ func stringToInt(s string) (int, error) {
 	}
 	return val, nil
 }
+
+// optionalInt converts the environment variable with the given name to an integer.
+// It returns def if the variable is not set.
+func optionalInt(name string, def int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	return stringToInt(value)
+}
+
+// optionalBool converts the environment variable with the given name to a boolean.
+// It returns def if the variable is not set.
+func optionalBool(name string, def bool) (bool, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// RateLimit allows Limit requests per Period.
+type RateLimit struct {
+	Limit  int
+	Period time.Duration
+}
+
+// optionalRateLimit parses the environment variable with the given name as a rate limit in the form
+// "<limit>/<period>", e.g. "10/1m". It returns nil if the variable is "off", and parses def if it is not set.
+func optionalRateLimit(name string, def string) (*RateLimit, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		value = def
+	}
+	if value == "off" {
+		return nil, nil
+	}
+	limitText, periodText, ok := strings.Cut(value, "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid rate limit")
+	}
+	limit, err := strconv.Atoi(limitText)
+	if err != nil || limit <= 0 {
+		return nil, fmt.Errorf("invalid rate limit")
+	}
+	period, err := time.ParseDuration(periodText)
+	if err != nil || period <= 0 {
+		return nil, fmt.Errorf("invalid rate limit period")
+	}
+	return &RateLimit{Limit: limit, Period: period}, nil
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+// newJWK wraps a raw key into a JWK for signatures with the given algorithm.
+// The kid is the RFC 7638 thumbprint of the public key, so the private key and
+// its public key always end up with the same kid.
+func newJWK(raw any, alg string) (jwk.Key, error) {
+	key, err := jwk.FromRaw(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := jwk.AssignKeyID(key); err != nil {
+		return nil, err
+	}
+	if err := key.Set(jwk.AlgorithmKey, jwa.SignatureAlgorithm(alg)); err != nil {
+		return nil, err
+	}
+	if err := key.Set(jwk.KeyUsageKey, jwk.ForSignature); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// loadPublicKey reads a PEM encoded PKIX or PKCS#1 (RSA) public key from a file.
+func loadPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading public key file: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("public key %s is not PEM encoded", path)
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	return nil, fmt.Errorf("unsupported PEM block type %q in %s", block.Type, path)
+}
+
+// algorithmForKey returns the algorithm a public key is used with. RSA keys use
+// JWT_ALGORITHM when it is an RSA algorithm and RS256 otherwise.
+func algorithmForKey(key crypto.PublicKey) string {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if strings.HasPrefix(Envs.JWT_ALGORITHM, "RS") || strings.HasPrefix(Envs.JWT_ALGORITHM, "PS") {
+			return Envs.JWT_ALGORITHM
+		}
+		return "RS256"
+	case *ecdsa.PublicKey:
+		switch k.Curve.Params().BitSize {
+		case 384:
+			return "ES384"
+		case 521:
+			return "ES512"
+		}
+		return "ES256"
+	case ed25519.PublicKey:
+		return "EdDSA"
+	}
+	return Envs.JWT_ALGORITHM
+}
@@ -1,7 +1,90 @@
 package config
 
-import "github.com/go-chi/jwtauth/v5"
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+)
 
-func newJWTAuthClient() *jwtauth.JWTAuth {
-	return jwtauth.New("HS256", []byte(Envs.JWT_SECRET_KEY), nil)
+// isSupportedAlgorithm reports whether alg can be used for signing tokens.
+func isSupportedAlgorithm(alg string) bool {
+	switch alg {
+	case "HS256", "HS384", "HS512",
+		"RS256", "RS384", "RS512",
+		"PS256", "PS384", "PS512",
+		"ES256", "ES384", "ES512",
+		"EdDSA":
+		return true
+	}
+	return false
+}
+
+// isHMACAlgorithm reports whether alg signs tokens with a shared secret.
+func isHMACAlgorithm(alg string) bool {
+	return strings.HasPrefix(alg, "HS")
+}
+
+// loadPrivateKey reads a PEM encoded PKCS#8, PKCS#1 (RSA) or SEC 1 (EC) private key from a file.
+func loadPrivateKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading private key file: %w", err)
+	}
+	return parsePrivateKey(data)
+}
+
+// parsePrivateKey parses a PEM encoded PKCS#8, PKCS#1 (RSA) or SEC 1 (EC) private key.
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("private key is not PEM encoded")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	}
+	return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+}
+
+// checkKeyAlgorithm makes sure that the private key can be used with the signing algorithm.
+func checkKeyAlgorithm(alg string, key crypto.Signer) error {
+	var ok bool
+	switch {
+	case strings.HasPrefix(alg, "RS"), strings.HasPrefix(alg, "PS"):
+		_, ok = key.(*rsa.PrivateKey)
+	case alg == "ES256":
+		k, isEC := key.(*ecdsa.PrivateKey)
+		ok = isEC && k.Curve.Params().BitSize == 256
+	case alg == "ES384":
+		k, isEC := key.(*ecdsa.PrivateKey)
+		ok = isEC && k.Curve.Params().BitSize == 384
+	case alg == "ES512":
+		k, isEC := key.(*ecdsa.PrivateKey)
+		ok = isEC && k.Curve.Params().BitSize == 521
+	case alg == "EdDSA":
+		_, ok = key.(ed25519.PrivateKey)
+	}
+	if !ok {
+		return fmt.Errorf("private key of type %T can't be used with %s", key, alg)
+	}
+	return nil
 }
@@ -0,0 +1,439 @@
+package config
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"maps"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/utils"
+)
+
+// SigningKey is a single key of the KeyRing.
+type SigningKey struct {
+	ID        string
+	Algorithm jwa.SignatureAlgorithm
+	// signKey is nil for keys which only verify tokens (e.g. previous public keys).
+	signKey   any
+	verifyKey any
+	// public is the JWK published in the JWKS, nil for HMAC keys.
+	public jwk.Key
+	// retireAt is set once the key was removed from the key directory,
+	// the key keeps verifying tokens until then.
+	retireAt time.Time
+	// pinned keys come from JWT_PREVIOUS_PUBLIC_KEY_FILES rather than the key directory,
+	// so reloading the directory never retires them.
+	pinned bool
+}
+
+// KeyRing holds every key which verifies our tokens, looked up by the kid token header,
+// and the active key which signs new tokens. Keys are either configured with a single
+// JWT_SECRET_KEY / JWT_PRIVATE_KEY_FILE or loaded from the JWT_KEYS_DIR directory, which
+// is reloaded periodically and on SIGHUP so keys can be rotated without a restart.
+type KeyRing struct {
+	mu     sync.RWMutex
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+// newKeyRing creates the KeyRing from the JWT environment variables.
+func newKeyRing() (*KeyRing, error) {
+	k := &KeyRing{keys: map[string]*SigningKey{}}
+
+	if Envs.JWT_KEYS_DIR != "" {
+		if err := k.Reload(); err != nil {
+			return nil, err
+		}
+	} else {
+		key, err := newConfiguredSigningKey()
+		if err != nil {
+			return nil, err
+		}
+		k.keys[key.ID] = key
+		k.active = key
+	}
+
+	for _, path := range strings.Split(Envs.JWT_PREVIOUS_PUBLIC_KEY_FILES, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		publicKey, err := loadPublicKey(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := newSigningKey("", algorithmForKey(publicKey), nil, publicKey)
+		if err != nil {
+			return nil, err
+		}
+		key.pinned = true
+		if _, ok := k.keys[key.ID]; !ok {
+			k.keys[key.ID] = key
+		}
+	}
+	return k, nil
+}
+
+// newConfiguredSigningKey creates the signing key configured with JWT_SECRET_KEY
+// for HMAC algorithms or JWT_PRIVATE_KEY_FILE for every other algorithm.
+func newConfiguredSigningKey() (*SigningKey, error) {
+	if isHMACAlgorithm(Envs.JWT_ALGORITHM) {
+		return newSigningKey("", Envs.JWT_ALGORITHM, []byte(Envs.JWT_SECRET_KEY), nil)
+	}
+
+	privateKey, err := loadPrivateKey(Envs.JWT_PRIVATE_KEY_FILE)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkKeyAlgorithm(Envs.JWT_ALGORITHM, privateKey); err != nil {
+		return nil, err
+	}
+	return newSigningKey("", Envs.JWT_ALGORITHM, privateKey, privateKey.Public())
+}
+
+// newSigningKey creates a key of the KeyRing. signKey is either an HMAC secret or a private key
+// and may be nil for keys which only verify, publicKey is nil for HMAC secrets.
+// Without an explicit kid, asymmetric keys use the RFC 7638 thumbprint of the public key and
+// HMAC secrets a prefix of the secret's SHA-256 digest.
+func newSigningKey(kid string, alg string, signKey any, publicKey crypto.PublicKey) (*SigningKey, error) {
+	key := &SigningKey{ID: kid, Algorithm: jwa.SignatureAlgorithm(alg)}
+
+	if publicKey == nil {
+		secret, ok := signKey.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("missing key for %s", alg)
+		}
+		if key.ID == "" {
+			sum := sha256.Sum256(secret)
+			key.ID = hex.EncodeToString(sum[:8])
+		}
+		hmacKey, err := jwk.FromRaw(secret)
+		if err != nil {
+			return nil, err
+		}
+		if err := hmacKey.Set(jwk.KeyIDKey, key.ID); err != nil {
+			return nil, err
+		}
+		key.signKey = hmacKey
+		key.verifyKey = secret
+		return key, nil
+	}
+
+	public, err := newJWK(publicKey, alg)
+	if err != nil {
+		return nil, err
+	}
+	if key.ID == "" {
+		key.ID = public.KeyID()
+	}
+	if err := public.Set(jwk.KeyIDKey, key.ID); err != nil {
+		return nil, err
+	}
+	key.public = public
+	key.verifyKey = public
+
+	if signKey != nil {
+		// Signing with a JWK which carries a kid adds the kid to the token header.
+		private, err := newJWK(signKey, alg)
+		if err != nil {
+			return nil, err
+		}
+		if err := private.Set(jwk.KeyIDKey, key.ID); err != nil {
+			return nil, err
+		}
+		key.signKey = private
+	}
+	return key, nil
+}
+
+// Encode signs the claims with the active key and returns the token string.
+// The kid of the active key is set in the token header.
+func (k *KeyRing) Encode(claims map[string]any) (string, error) {
+	k.mu.RLock()
+	active := k.active
+	k.mu.RUnlock()
+
+	token := jwt.New()
+	for name, value := range claims {
+		if err := token.Set(name, value); err != nil {
+			return "", err
+		}
+	}
+	signed, err := jwt.Sign(token, jwt.WithKey(active.Algorithm, active.signKey))
+	if err != nil {
+		return "", err
+	}
+	return string(signed), nil
+}
+
+// Verify verifies the signature of a token with the key named by its kid header and validates its
+// time based claims. Tokens without a kid, which were signed before keys got one, are verified with
+// the active key. Errors are normalised the same way jwtauth does, e.g. jwtauth.ErrExpired.
+func (k *KeyRing) Verify(tokenString string) (jwt.Token, error) {
+	msg, err := jws.Parse([]byte(tokenString))
+	if err != nil || len(msg.Signatures()) != 1 {
+		return nil, jwtauth.ErrUnauthorized
+	}
+	kid := msg.Signatures()[0].ProtectedHeaders().KeyID()
+
+	key := k.lookup(kid)
+	if key == nil {
+		return nil, jwtauth.ErrUnauthorized
+	}
+
+	token, err := jwt.Parse([]byte(tokenString), jwt.WithKey(key.Algorithm, key.verifyKey), jwt.WithValidate(false))
+	if err != nil {
+		return nil, jwtauth.ErrorReason(err)
+	}
+	if err := jwt.Validate(token); err != nil {
+		return token, jwtauth.ErrorReason(err)
+	}
+	return token, nil
+}
+
+// lookup returns the key with the given kid, or the active key for an empty kid.
+// Retired keys whose grace period ended are not returned.
+func (k *KeyRing) lookup(kid string) *SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if kid == "" {
+		return k.active
+	}
+	key, ok := k.keys[kid]
+	if !ok || (!key.retireAt.IsZero() && time.Now().After(key.retireAt)) {
+		return nil
+	}
+	return key
+}
+
+// JWKS returns the public keys which currently verify tokens, the active key first.
+func (k *KeyRing) JWKS() jwk.Set {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	keySet := jwk.NewSet()
+	if k.active.public != nil {
+		keySet.AddKey(k.active.public)
+	}
+	for _, id := range slices.Sorted(maps.Keys(k.keys)) {
+		key := k.keys[id]
+		if key == k.active || key.public == nil || (!key.retireAt.IsZero() && time.Now().After(key.retireAt)) {
+			continue
+		}
+		keySet.AddKey(key.public)
+	}
+	return keySet
+}
+
+// Algorithms returns the sorted signing algorithms of the keys which still verify tokens,
+// including retired keys within their grace period.
+func (k *KeyRing) Algorithms() []string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	now := time.Now()
+	algs := []string{k.active.Algorithm.String()}
+	for _, key := range k.keys {
+		if (key.retireAt.IsZero() || !now.After(key.retireAt)) && !slices.Contains(algs, key.Algorithm.String()) {
+			algs = append(algs, key.Algorithm.String())
+		}
+	}
+	slices.Sort(algs)
+	return algs
+}
+
+// Reload loads the keys of JWT_KEYS_DIR. Every `<kid>.pem` file holds a PEM private key and every
+// `<kid>.key` file an HMAC secret. The key whose file name sorts last becomes the active key, so
+// naming files by creation time (as the rotate-keys command does) makes the newest key sign.
+// Keys whose file was removed are retired: they keep verifying tokens for JWT_KEYS_GRACE_PERIOD
+// minutes, so tokens signed shortly before the removal stay valid, and are dropped afterwards.
+// The keys of JWT_PREVIOUS_PUBLIC_KEY_FILES aren't in the directory and are never retired.
+func (k *KeyRing) Reload() error {
+	loaded, err := loadKeysDir(Envs.JWT_KEYS_DIR)
+	if err != nil {
+		return err
+	}
+	if len(loaded) == 0 {
+		return fmt.Errorf("no keys found in %s", Envs.JWT_KEYS_DIR)
+	}
+	ids := slices.Sorted(maps.Keys(loaded))
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := time.Now()
+	for id, key := range k.keys {
+		if _, ok := loaded[id]; ok || key.pinned {
+			continue
+		}
+		if key.retireAt.IsZero() {
+			key.retireAt = now.Add(time.Duration(Envs.JWT_KEYS_GRACE_PERIOD) * time.Minute)
+			utils.Log.Info("signing key retired", "kid", id, "retire_at", key.retireAt)
+		} else if now.After(key.retireAt) {
+			delete(k.keys, id)
+		}
+	}
+	for id, key := range loaded {
+		if _, ok := k.keys[id]; !ok {
+			utils.Log.Info("signing key loaded", "kid", id)
+		}
+		k.keys[id] = key
+	}
+
+	active := loaded[ids[len(ids)-1]]
+	if k.active == nil || k.active.ID != active.ID {
+		utils.Log.Info("signing key activated", "kid", active.ID)
+	}
+	k.active = active
+	return nil
+}
+
+// watch reloads JWT_KEYS_DIR every JWT_KEYS_RELOAD_INTERVAL_SEC seconds and whenever the process
+// receives SIGHUP. A failed reload keeps the current keys.
+func (k *KeyRing) watch() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	ticker := time.NewTicker(time.Duration(Envs.JWT_KEYS_RELOAD_INTERVAL_SEC) * time.Second)
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+			case <-hup:
+			}
+			if err := k.Reload(); err != nil {
+				utils.Log.Error("error reloading signing keys", "error", err)
+			}
+		}
+	}()
+}
+
+// loadKeysDir loads every key file of dir, keyed by kid.
+func loadKeysDir(dir string) (map[string]*SigningKey, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading keys dir: %w", err)
+	}
+
+	keys := map[string]*SigningKey{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		ext := filepath.Ext(entry.Name())
+		kid := strings.TrimSuffix(entry.Name(), ext)
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error reading key %s: %w", entry.Name(), err)
+		}
+
+		var key *SigningKey
+		switch ext {
+		case ".key":
+			if !isHMACAlgorithm(Envs.JWT_ALGORITHM) {
+				return nil, fmt.Errorf("key %s is an HMAC secret but JWT_ALGORITHM is %s", entry.Name(), Envs.JWT_ALGORITHM)
+			}
+			key, err = newSigningKey(kid, Envs.JWT_ALGORITHM, []byte(strings.TrimSpace(string(data))), nil)
+		case ".pem":
+			var privateKey crypto.Signer
+			privateKey, err = parsePrivateKey(data)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing key %s: %w", entry.Name(), err)
+			}
+			alg := Envs.JWT_ALGORITHM
+			if checkKeyAlgorithm(alg, privateKey) != nil {
+				alg = algorithmForKey(privateKey.Public())
+			}
+			key, err = newSigningKey(kid, alg, privateKey, privateKey.Public())
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys[kid] = key
+	}
+	return keys, nil
+}
+
+// GenerateKeyFile creates a new key for JWT_ALGORITHM in JWT_KEYS_DIR and returns its path.
+// The file is named after the current UTC time, so it sorts last and becomes the active key
+// once the running servers reload the directory.
+func GenerateKeyFile() (string, error) {
+	if Envs.JWT_KEYS_DIR == "" {
+		return "", fmt.Errorf("JWT_KEYS_DIR is not set")
+	}
+	kid := time.Now().UTC().Format("20060102T150405Z")
+
+	var data []byte
+	ext := ".pem"
+	if isHMACAlgorithm(Envs.JWT_ALGORITHM) {
+		secret := make([]byte, 64)
+		if _, err := rand.Read(secret); err != nil {
+			return "", err
+		}
+		data = []byte(hex.EncodeToString(secret))
+		ext = ".key"
+	} else {
+		privateKey, err := generatePrivateKey(Envs.JWT_ALGORITHM)
+		if err != nil {
+			return "", err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		if err != nil {
+			return "", err
+		}
+		data = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	}
+
+	path := filepath.Join(Envs.JWT_KEYS_DIR, kid+ext)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := file.Write(data); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// generatePrivateKey creates a new private key for an asymmetric signing algorithm.
+func generatePrivateKey(alg string) (crypto.Signer, error) {
+	switch {
+	case strings.HasPrefix(alg, "RS"), strings.HasPrefix(alg, "PS"):
+		return rsa.GenerateKey(rand.Reader, 3072)
+	case alg == "ES256":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case alg == "ES384":
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case alg == "ES512":
+		return ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case alg == "EdDSA":
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		return privateKey, err
+	}
+	return nil, fmt.Errorf("can't generate a key for %s", alg)
+}
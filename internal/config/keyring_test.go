@@ -0,0 +1,215 @@
+package config
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jws"
+)
+
+// setupKeysDir points the envs at a new key directory with the given grace period in minutes.
+func setupKeysDir(t *testing.T, gracePeriod int) string {
+	t.Helper()
+	dir := t.TempDir()
+	Envs = &AppEnvs{
+		JWT_ALGORITHM:                "ES256",
+		JWT_KEYS_DIR:                 dir,
+		JWT_KEYS_GRACE_PERIOD:        gracePeriod,
+		JWT_KEYS_RELOAD_INTERVAL_SEC: 3600,
+	}
+	return dir
+}
+
+// writeKeyFile writes a new private key of the algorithm as <kid>.pem into dir and returns it.
+func writeKeyFile(t *testing.T, dir string, kid string, alg string) crypto.Signer {
+	t.Helper()
+	privateKey, err := generatePrivateKey(alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return privateKey
+}
+
+func signTestToken(t *testing.T, k *KeyRing) string {
+	t.Helper()
+	token, err := k.Encode(map[string]any{"sub": "1", "exp": time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func tokenKeyID(t *testing.T, token string) string {
+	t.Helper()
+	msg, err := jws.Parse([]byte(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg.Signatures()[0].ProtectedHeaders().KeyID()
+}
+
+func TestKeyRingRotation(t *testing.T) {
+	dir := setupKeysDir(t, 1)
+	writeKeyFile(t, dir, "20240101T000000Z", "ES256")
+	k, err := newKeyRing()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldToken := signTestToken(t, k)
+	if kid := tokenKeyID(t, oldToken); kid != "20240101T000000Z" {
+		t.Fatalf("token signed with kid %q", kid)
+	}
+	if _, err := k.Verify(oldToken); err != nil {
+		t.Fatalf("token of the active key doesn't verify: %v", err)
+	}
+
+	// The newer key takes over signing, the old one keeps verifying.
+	writeKeyFile(t, dir, "20240201T000000Z", "EdDSA")
+	if err := k.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	newToken := signTestToken(t, k)
+	if kid := tokenKeyID(t, newToken); kid != "20240201T000000Z" {
+		t.Fatalf("token signed with kid %q after rotation", kid)
+	}
+	for _, token := range []string{oldToken, newToken} {
+		if _, err := k.Verify(token); err != nil {
+			t.Fatalf("token doesn't verify after rotation: %v", err)
+		}
+	}
+
+	// Within the grace period the removed key still verifies and is still published.
+	if err := os.Remove(filepath.Join(dir, "20240101T000000Z.pem")); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.Verify(oldToken); err != nil {
+		t.Fatalf("token of a retired key doesn't verify within the grace period: %v", err)
+	}
+	if _, ok := k.JWKS().LookupKeyID("20240101T000000Z"); !ok {
+		t.Error("retired key is missing from the JWKS within the grace period")
+	}
+	if algs := k.Algorithms(); !slices.Equal(algs, []string{"ES256", "EdDSA"}) {
+		t.Errorf("got algorithms %v within the grace period", algs)
+	}
+
+	// After the grace period the key is refused and dropped on the next reload.
+	k.keys["20240101T000000Z"].retireAt = time.Now().Add(-time.Second)
+	if _, err := k.Verify(oldToken); err == nil {
+		t.Fatal("token of a retired key verifies after the grace period")
+	}
+	if _, ok := k.JWKS().LookupKeyID("20240101T000000Z"); ok {
+		t.Error("retired key is still in the JWKS after the grace period")
+	}
+	if algs := k.Algorithms(); !slices.Equal(algs, []string{"EdDSA"}) {
+		t.Errorf("got algorithms %v after the grace period", algs)
+	}
+	if err := k.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := k.keys["20240101T000000Z"]; ok {
+		t.Error("retired key wasn't dropped after the grace period")
+	}
+	if _, err := k.Verify(newToken); err != nil {
+		t.Fatalf("token of the active key doesn't verify: %v", err)
+	}
+}
+
+func TestKeyRingUnknownKeyID(t *testing.T) {
+	dir := setupKeysDir(t, 1)
+	writeKeyFile(t, dir, "a", "ES256")
+	k, err := newKeyRing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := signTestToken(t, k)
+
+	// A key ring which never had the key refuses the token.
+	otherDir := setupKeysDir(t, 1)
+	writeKeyFile(t, otherDir, "b", "ES256")
+	other, err := newKeyRing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Verify(token); err == nil {
+		t.Fatal("token of an unknown kid verifies")
+	}
+}
+
+func TestKeyRingPreviousPublicKeys(t *testing.T) {
+	// Tokens signed by the single configured key, before moving to a key directory.
+	keyDir := t.TempDir()
+	privateKey := writeKeyFile(t, keyDir, "previous", "ES256")
+	Envs = &AppEnvs{JWT_ALGORITHM: "ES256", JWT_PRIVATE_KEY_FILE: filepath.Join(keyDir, "previous.pem")}
+	previous, err := newKeyRing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := signTestToken(t, previous)
+
+	der, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyFile := filepath.Join(keyDir, "previous.pub")
+	if err := os.WriteFile(publicKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a grace period, a key missing from the directory would be dropped on the second reload.
+	dir := setupKeysDir(t, 0)
+	Envs.JWT_PREVIOUS_PUBLIC_KEY_FILES = publicKeyFile
+	writeKeyFile(t, dir, "current", "ES256")
+	k, err := newKeyRing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := k.Reload(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := k.Verify(token); err != nil {
+			t.Fatalf("token of a previous key doesn't verify after reload %d: %v", i+1, err)
+		}
+	}
+}
+
+func TestKeyRingReloadOnSIGHUP(t *testing.T) {
+	dir := setupKeysDir(t, 1)
+	writeKeyFile(t, dir, "a", "ES256")
+	k, err := newKeyRing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.watch()
+
+	writeKeyFile(t, dir, "b", "ES256")
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if kid := tokenKeyID(t, signTestToken(t, k)); kid == "b" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("key directory wasn't reloaded on SIGHUP")
+}
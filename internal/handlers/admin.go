@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/models"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/service"
+)
+
+type AdminHandlers struct {
+	svc service.AuthServiceInterface
+}
+
+func NewAdminHandlers() AdminHandlersInterface {
+	return &AdminHandlers{
+		svc: service.NewAuthService(),
+	}
+}
+
+// RevokeAccessToken puts the access token with the given jti on the revocation denylist.
+func (h *AdminHandlers) RevokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	var body *models.RevokeAccessTokenReqBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body == nil {
+		models.ResponseWithJSON(w, http.StatusBadRequest, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide valid input")))
+		return
+	}
+	defer r.Body.Close()
+
+	result, err := h.svc.RevokeAccessToken(r.Context(), body)
+	if err != nil {
+		models.ResponseWithJSON(w, err.Status, err)
+		return
+	}
+	models.ResponseWithJSON(w, result.Status, result)
+}
+
+// UnlockUser lifts the lockout after failed logins of the user with the given ID.
+func (h *AdminHandlers) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		models.ResponseWithJSON(w, http.StatusBadRequest, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide a valid user id")))
+		return
+	}
+
+	result, errRes := h.svc.UnlockUser(r.Context(), userID)
+	if errRes != nil {
+		models.ResponseWithJSON(w, errRes.Status, errRes)
+		return
+	}
+	models.ResponseWithJSON(w, result.Status, result)
+}
@@ -3,8 +3,11 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/the-arcade-01/golang-jwt-authentication/internal/config"
 	"github.com/the-arcade-01/golang-jwt-authentication/internal/models"
 	"github.com/the-arcade-01/golang-jwt-authentication/internal/service"
@@ -27,7 +30,7 @@ func (h *AuthHandlers) Greet(w http.ResponseWriter, r *http.Request) {
 
 func (h *AuthHandlers) CreateUser(w http.ResponseWriter, r *http.Request) {
 	var body *models.AuthReqBody
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body == nil {
 		models.ResponseWithJSON(w, http.StatusBadRequest, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide valid input")))
 		return
 	}
@@ -42,8 +45,11 @@ func (h *AuthHandlers) CreateUser(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AuthHandlers) LogoutUser(w http.ResponseWriter, r *http.Request) {
-	userID := int(r.Context().Value(utils.UserIDCtxKey).(float64))
-	result, err := h.svc.LogoutUser(r.Context(), userID)
+	userID := r.Context().Value(utils.UserIDCtxKey).(int)
+	sessionID := r.Context().Value(utils.SessionIDCtxKey).(string)
+	tokenID := r.Context().Value(utils.TokenIDCtxKey).(string)
+	tokenExpireTime := r.Context().Value(utils.TokenExpireTimeCtxKey).(int64)
+	result, err := h.svc.LogoutUser(r.Context(), userID, sessionID, tokenID, tokenExpireTime)
 	if err != nil {
 		models.ResponseWithJSON(w, err.Status, err)
 		return
@@ -54,8 +60,10 @@ func (h *AuthHandlers) LogoutUser(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AuthHandlers) DeleteUser(w http.ResponseWriter, r *http.Request) {
-	userID := int(r.Context().Value(utils.UserIDCtxKey).(float64))
-	result, err := h.svc.DeleteUser(r.Context(), userID)
+	userID := r.Context().Value(utils.UserIDCtxKey).(int)
+	tokenID := r.Context().Value(utils.TokenIDCtxKey).(string)
+	tokenExpireTime := r.Context().Value(utils.TokenExpireTimeCtxKey).(int64)
+	result, err := h.svc.DeleteUser(r.Context(), userID, tokenID, tokenExpireTime)
 	if err != nil {
 		models.ResponseWithJSON(w, err.Status, err)
 		return
@@ -64,7 +72,7 @@ func (h *AuthHandlers) DeleteUser(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AuthHandlers) GetUserByID(w http.ResponseWriter, r *http.Request) {
-	userID := int(r.Context().Value(utils.UserIDCtxKey).(float64))
+	userID := r.Context().Value(utils.UserIDCtxKey).(int)
 	result, err := h.svc.GetUserByID(r.Context(), userID)
 	if err != nil {
 		models.ResponseWithJSON(w, err.Status, err)
@@ -75,7 +83,7 @@ func (h *AuthHandlers) GetUserByID(w http.ResponseWriter, r *http.Request) {
 
 func (h *AuthHandlers) LoginUser(w http.ResponseWriter, r *http.Request) {
 	var body *models.AuthReqBody
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body == nil {
 		models.ResponseWithJSON(w, http.StatusBadRequest, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide valid input")))
 		return
 	}
@@ -87,12 +95,36 @@ func (h *AuthHandlers) LoginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// With two-factor authentication there is no session yet, the cookie is set by LoginMFA.
+	if tokensResponse.MFAToken == "" {
+		h.setCookie(w, tokensResponse.RefreshToken)
+	}
+	models.ResponseWithJSON(w, http.StatusOK, &models.Response{Success: true, Status: http.StatusOK, Data: tokensResponse})
+}
+
+// LoginMFA finishes a login with two-factor authentication, exchanging the mfa_token returned by LoginUser
+// and a code for the tokens. Like LoginUser, it sets the refresh token in the cookie.
+func (h *AuthHandlers) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var body *models.MFALoginReqBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body == nil {
+		models.ResponseWithJSON(w, http.StatusBadRequest, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide valid input")))
+		return
+	}
+	defer r.Body.Close()
+
+	tokensResponse, err := h.svc.LoginMFA(r.Context(), body)
+	if err != nil {
+		models.ResponseWithJSON(w, err.Status, err)
+		return
+	}
+
 	h.setCookie(w, tokensResponse.RefreshToken)
 	models.ResponseWithJSON(w, http.StatusOK, &models.Response{Success: true, Status: http.StatusOK, Data: tokensResponse})
 }
 
-// RefreshToken handles the token refresh process for authenticated users.
+// RefreshToken handles the token refresh process.
 // It retrieves the JWT cookie from the request, validates it, and generates new access and refresh tokens.
+// The user is authenticated by the refresh token in the cookie alone, so it works with an expired access token.
 // If the JWT cookie is missing or invalid, it responds with an unauthorized status.
 // If the token generation is successful, it sets the new refresh token in the cookie and responds with the new access token.
 //
@@ -104,8 +136,7 @@ func (h *AuthHandlers) RefreshToken(w http.ResponseWriter, r *http.Request) {
 		models.ResponseWithJSON(w, http.StatusUnauthorized, models.NewErrorResponse(http.StatusUnauthorized, fmt.Errorf("please login again")))
 		return
 	}
-	userID := int(r.Context().Value(utils.UserIDCtxKey).(float64))
-	tokensResponse, er := h.svc.GenerateTokens(r.Context(), userID, cookie.Value)
+	tokensResponse, er := h.svc.GenerateTokens(r.Context(), cookie.Value)
 	if er != nil {
 		models.ResponseWithJSON(w, er.Status, er)
 		return
@@ -115,6 +146,430 @@ func (h *AuthHandlers) RefreshToken(w http.ResponseWriter, r *http.Request) {
 	models.ResponseWithJSON(w, http.StatusOK, &models.Response{Success: true, Status: http.StatusOK, Data: tokensResponse})
 }
 
+// IntrospectToken implements RFC 7662 token introspection for resource servers which can't verify tokens
+// themselves. The token and the optional token_type_hint are sent form encoded, the calling client is
+// authenticated by the requireIntrospectionClient middleware.
+func (h *AuthHandlers) IntrospectToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		models.ResponseWithJSON(w, http.StatusBadRequest, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide valid input")))
+		return
+	}
+
+	result, err := h.svc.IntrospectToken(r.Context(), r.PostForm.Get("token"), r.PostForm.Get("token_type_hint"))
+	if err != nil {
+		models.ResponseWithJSON(w, err.Status, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	models.ResponseWithJSON(w, http.StatusOK, result)
+}
+
+// RevokeToken implements RFC 7009 token revocation for a single access or refresh token. The token and the
+// optional token_type_hint are sent form encoded. Invalid tokens are answered with 200 as well, as the RFC
+// requires, so only a failure to store the revocation leads to an error. The route needs no other
+// authentication, holding the token is enough to revoke it.
+func (h *AuthHandlers) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		models.ResponseWithJSON(w, http.StatusBadRequest, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide valid input")))
+		return
+	}
+
+	result, err := h.svc.RevokeToken(r.Context(), r.PostForm.Get("token"), r.PostForm.Get("token_type_hint"))
+	if err != nil {
+		models.ResponseWithJSON(w, err.Status, err)
+		return
+	}
+	models.ResponseWithJSON(w, result.Status, result)
+}
+
+func (h *AuthHandlers) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var body *models.TokenReqBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body == nil {
+		models.ResponseWithJSON(w, http.StatusBadRequest, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide valid input")))
+		return
+	}
+	defer r.Body.Close()
+
+	result, err := h.svc.VerifyEmail(r.Context(), body)
+	if err != nil {
+		models.ResponseWithJSON(w, err.Status, err)
+		return
+	}
+	models.ResponseWithJSON(w, result.Status, result)
+}
+
+func (h *AuthHandlers) ResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	var body *models.EmailReqBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body == nil {
+		models.ResponseWithJSON(w, http.StatusBadRequest, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide valid input")))
+		return
+	}
+	defer r.Body.Close()
+
+	result, err := h.svc.ResendVerificationEmail(r.Context(), body)
+	if err != nil {
+		models.ResponseWithJSON(w, err.Status, err)
+		return
+	}
+	models.ResponseWithJSON(w, result.Status, result)
+}
+
+func (h *AuthHandlers) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var body *models.EmailReqBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body == nil {
+		models.ResponseWithJSON(w, http.StatusBadRequest, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide valid input")))
+		return
+	}
+	defer r.Body.Close()
+
+	result, err := h.svc.ForgotPassword(r.Context(), body)
+	if err != nil {
+		models.ResponseWithJSON(w, err.Status, err)
+		return
+	}
+	models.ResponseWithJSON(w, result.Status, result)
+}
+
+func (h *AuthHandlers) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var body *models.ResetPasswordReqBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body == nil {
+		models.ResponseWithJSON(w, http.StatusBadRequest, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide valid input")))
+		return
+	}
+	defer r.Body.Close()
+
+	result, err := h.svc.ResetPassword(r.Context(), body)
+	if err != nil {
+		models.ResponseWithJSON(w, err.Status, err)
+		return
+	}
+	models.ResponseWithJSON(w, result.Status, result)
+}
+
+func (h *AuthHandlers) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.UserIDCtxKey).(int)
+	sessionID := r.Context().Value(utils.SessionIDCtxKey).(string)
+	var body *models.ChangePasswordReqBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body == nil {
+		models.ResponseWithJSON(w, http.StatusBadRequest, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide valid input")))
+		return
+	}
+	defer r.Body.Close()
+
+	result, err := h.svc.ChangePassword(r.Context(), userID, sessionID, body)
+	if err != nil {
+		models.ResponseWithJSON(w, err.Status, err)
+		return
+	}
+	models.ResponseWithJSON(w, result.Status, result)
+}
+
+func (h *AuthHandlers) RequestEmailChange(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.UserIDCtxKey).(int)
+	var body *models.ChangeEmailReqBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body == nil {
+		models.ResponseWithJSON(w, http.StatusBadRequest, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide valid input")))
+		return
+	}
+	defer r.Body.Close()
+
+	result, err := h.svc.RequestEmailChange(r.Context(), userID, body)
+	if err != nil {
+		models.ResponseWithJSON(w, err.Status, err)
+		return
+	}
+	models.ResponseWithJSON(w, result.Status, result)
+}
+
+func (h *AuthHandlers) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	var body *models.TokenReqBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body == nil {
+		models.ResponseWithJSON(w, http.StatusBadRequest, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide valid input")))
+		return
+	}
+	defer r.Body.Close()
+
+	result, err := h.svc.ConfirmEmailChange(r.Context(), body)
+	if err != nil {
+		models.ResponseWithJSON(w, err.Status, err)
+		return
+	}
+	models.ResponseWithJSON(w, result.Status, result)
+}
+
+func (h *AuthHandlers) CancelEmailChange(w http.ResponseWriter, r *http.Request) {
+	var body *models.TokenReqBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body == nil {
+		models.ResponseWithJSON(w, http.StatusBadRequest, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide valid input")))
+		return
+	}
+	defer r.Body.Close()
+
+	result, err := h.svc.CancelEmailChange(r.Context(), body)
+	if err != nil {
+		models.ResponseWithJSON(w, err.Status, err)
+		return
+	}
+	models.ResponseWithJSON(w, result.Status, result)
+}
+
+func (h *AuthHandlers) UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	var body *models.TokenReqBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body == nil {
+		models.ResponseWithJSON(w, http.StatusBadRequest, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide valid input")))
+		return
+	}
+	defer r.Body.Close()
+
+	result, err := h.svc.UnlockAccount(r.Context(), body)
+	if err != nil {
+		models.ResponseWithJSON(w, err.Status, err)
+		return
+	}
+	models.ResponseWithJSON(w, result.Status, result)
+}
+
+// EnrollTOTP starts setting up two-factor authentication with an authenticator app. Like the other
+// TOTP routes, it is only mounted when MFA_ENCRYPTION_KEY is set.
+func (h *AuthHandlers) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.UserIDCtxKey).(int)
+	result, err := h.svc.EnrollTOTP(r.Context(), userID)
+	if err != nil {
+		models.ResponseWithJSON(w, err.Status, err)
+		return
+	}
+	models.ResponseWithJSON(w, result.Status, result)
+}
+
+func (h *AuthHandlers) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.UserIDCtxKey).(int)
+	var body *models.MFACodeReqBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body == nil {
+		models.ResponseWithJSON(w, http.StatusBadRequest, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide valid input")))
+		return
+	}
+	defer r.Body.Close()
+
+	result, err := h.svc.ConfirmTOTP(r.Context(), userID, body)
+	if err != nil {
+		models.ResponseWithJSON(w, err.Status, err)
+		return
+	}
+	models.ResponseWithJSON(w, result.Status, result)
+}
+
+func (h *AuthHandlers) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.UserIDCtxKey).(int)
+	var body *models.DisableMFAReqBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body == nil {
+		models.ResponseWithJSON(w, http.StatusBadRequest, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide valid input")))
+		return
+	}
+	defer r.Body.Close()
+
+	result, err := h.svc.DisableTOTP(r.Context(), userID, body)
+	if err != nil {
+		models.ResponseWithJSON(w, err.Status, err)
+		return
+	}
+	models.ResponseWithJSON(w, result.Status, result)
+}
+
+func (h *AuthHandlers) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.UserIDCtxKey).(int)
+	var body *models.MFACodeReqBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body == nil {
+		models.ResponseWithJSON(w, http.StatusBadRequest, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide valid input")))
+		return
+	}
+	defer r.Body.Close()
+
+	result, err := h.svc.RegenerateRecoveryCodes(r.Context(), userID, body)
+	if err != nil {
+		models.ResponseWithJSON(w, err.Status, err)
+		return
+	}
+	models.ResponseWithJSON(w, result.Status, result)
+}
+
+func (h *AuthHandlers) BeginWebAuthnRegistration(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.UserIDCtxKey).(int)
+	result, err := h.svc.BeginWebAuthnRegistration(r.Context(), userID)
+	if err != nil {
+		models.ResponseWithJSON(w, err.Status, err)
+		return
+	}
+	models.ResponseWithJSON(w, result.Status, result)
+}
+
+func (h *AuthHandlers) FinishWebAuthnRegistration(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.UserIDCtxKey).(int)
+	var body *models.WebAuthnRegisterReqBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body == nil {
+		models.ResponseWithJSON(w, http.StatusBadRequest, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide valid input")))
+		return
+	}
+	defer r.Body.Close()
+
+	result, err := h.svc.FinishWebAuthnRegistration(r.Context(), userID, body)
+	if err != nil {
+		models.ResponseWithJSON(w, err.Status, err)
+		return
+	}
+	models.ResponseWithJSON(w, result.Status, result)
+}
+
+// BeginWebAuthnLogin starts a passkey login. The body may be empty or carry an email address
+// to limit the passkeys offered by the browser to that account.
+func (h *AuthHandlers) BeginWebAuthnLogin(w http.ResponseWriter, r *http.Request) {
+	body := &models.EmailReqBody{}
+	if err := json.NewDecoder(r.Body).Decode(body); err != nil && err != io.EOF {
+		models.ResponseWithJSON(w, http.StatusBadRequest, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide valid input")))
+		return
+	}
+	defer r.Body.Close()
+
+	result, err := h.svc.BeginWebAuthnLogin(r.Context(), body)
+	if err != nil {
+		models.ResponseWithJSON(w, err.Status, err)
+		return
+	}
+	models.ResponseWithJSON(w, result.Status, result)
+}
+
+// FinishWebAuthnLogin finishes a passkey login with the assertion of the authenticator. Like LoginUser,
+// it responds with the access token and sets the refresh token in the cookie.
+func (h *AuthHandlers) FinishWebAuthnLogin(w http.ResponseWriter, r *http.Request) {
+	var body *models.WebAuthnLoginReqBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body == nil {
+		models.ResponseWithJSON(w, http.StatusBadRequest, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide valid input")))
+		return
+	}
+	defer r.Body.Close()
+
+	tokensResponse, err := h.svc.FinishWebAuthnLogin(r.Context(), body)
+	if err != nil {
+		models.ResponseWithJSON(w, err.Status, err)
+		return
+	}
+
+	h.setCookie(w, tokensResponse.RefreshToken)
+	models.ResponseWithJSON(w, http.StatusOK, &models.Response{Success: true, Status: http.StatusOK, Data: tokensResponse})
+}
+
+func (h *AuthHandlers) GetWebAuthnCredentials(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.UserIDCtxKey).(int)
+	result, err := h.svc.GetWebAuthnCredentials(r.Context(), userID)
+	if err != nil {
+		models.ResponseWithJSON(w, err.Status, err)
+		return
+	}
+	models.ResponseWithJSON(w, result.Status, result)
+}
+
+func (h *AuthHandlers) DeleteWebAuthnCredential(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.UserIDCtxKey).(int)
+	credentialID, err := strconv.Atoi(chi.URLParam(r, "credentialID"))
+	if err != nil {
+		models.ResponseWithJSON(w, http.StatusBadRequest, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide a valid passkey id")))
+		return
+	}
+
+	result, errRes := h.svc.DeleteWebAuthnCredential(r.Context(), userID, credentialID)
+	if errRes != nil {
+		models.ResponseWithJSON(w, errRes.Status, errRes)
+		return
+	}
+	models.ResponseWithJSON(w, result.Status, result)
+}
+
+// RequestMagicLink emails a passwordless login link. The response is the same whether or not an account
+// exists, and sets the nonce cookie which binds the link to this browser.
+func (h *AuthHandlers) RequestMagicLink(w http.ResponseWriter, r *http.Request) {
+	var body *models.EmailReqBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body == nil {
+		models.ResponseWithJSON(w, http.StatusBadRequest, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide valid input")))
+		return
+	}
+	defer r.Body.Close()
+
+	result, err := h.svc.RequestMagicLink(r.Context(), body)
+	if err != nil {
+		models.ResponseWithJSON(w, err.Status, err)
+		return
+	}
+
+	h.setMagicLinkCookie(w, result.Nonce, config.Envs.MAGIC_LINK_EXPIRE*60)
+	models.ResponseWithJSON(w, http.StatusOK, &models.Response{Success: true, Status: http.StatusOK, Data: "if an account exists for this email, a login link was sent to it"})
+}
+
+// VerifyMagicLink logs in with the token of a magic link and the nonce cookie of the browser that requested it.
+// Like LoginUser, it responds with the access token and sets the refresh token in the cookie.
+func (h *AuthHandlers) VerifyMagicLink(w http.ResponseWriter, r *http.Request) {
+	var body *models.TokenReqBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body == nil {
+		models.ResponseWithJSON(w, http.StatusBadRequest, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide valid input")))
+		return
+	}
+	defer r.Body.Close()
+
+	nonce := ""
+	if cookie, err := r.Cookie(magicLinkCookie); err == nil {
+		nonce = cookie.Value
+	}
+	tokensResponse, err := h.svc.VerifyMagicLink(r.Context(), body, nonce)
+	if err != nil {
+		models.ResponseWithJSON(w, err.Status, err)
+		return
+	}
+
+	h.setMagicLinkCookie(w, "", -1)
+	if tokensResponse.MFAToken == "" {
+		h.setCookie(w, tokensResponse.RefreshToken)
+	}
+	models.ResponseWithJSON(w, http.StatusOK, &models.Response{Success: true, Status: http.StatusOK, Data: tokensResponse})
+}
+
+// RequestEmailOTP emails a 6-digit login code, the alternative to a magic link for clients which can't
+// conveniently open links. The response is the same whether or not an account exists.
+func (h *AuthHandlers) RequestEmailOTP(w http.ResponseWriter, r *http.Request) {
+	var body *models.EmailReqBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body == nil {
+		models.ResponseWithJSON(w, http.StatusBadRequest, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide valid input")))
+		return
+	}
+	defer r.Body.Close()
+
+	result, err := h.svc.RequestEmailOTP(r.Context(), body)
+	if err != nil {
+		models.ResponseWithJSON(w, err.Status, err)
+		return
+	}
+	models.ResponseWithJSON(w, result.Status, result)
+}
+
+// VerifyEmailOTP logs in with the email address and the code sent to it.
+// Like LoginUser, it responds with the access token and sets the refresh token in the cookie.
+func (h *AuthHandlers) VerifyEmailOTP(w http.ResponseWriter, r *http.Request) {
+	var body *models.EmailOTPReqBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body == nil {
+		models.ResponseWithJSON(w, http.StatusBadRequest, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide valid input")))
+		return
+	}
+	defer r.Body.Close()
+
+	tokensResponse, err := h.svc.VerifyEmailOTP(r.Context(), body)
+	if err != nil {
+		models.ResponseWithJSON(w, err.Status, err)
+		return
+	}
+
+	if tokensResponse.MFAToken == "" {
+		h.setCookie(w, tokensResponse.RefreshToken)
+	}
+	models.ResponseWithJSON(w, http.StatusOK, &models.Response{Success: true, Status: http.StatusOK, Data: tokensResponse})
+}
+
 func (h *AuthHandlers) setCookie(w http.ResponseWriter, token string) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     "jwt",
@@ -124,3 +579,19 @@ func (h *AuthHandlers) setCookie(w http.ResponseWriter, token string) {
 		SameSite: http.SameSiteLaxMode,
 	})
 }
+
+// magicLinkCookie holds the nonce binding a magic link to the browser that requested it.
+// It is only sent to the magic link routes.
+const magicLinkCookie = "magic_link_nonce"
+
+func (h *AuthHandlers) setMagicLinkCookie(w http.ResponseWriter, nonce string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     magicLinkCookie,
+		Value:    nonce,
+		Path:     "/api/auth/login/magic",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   config.Envs.HTTP_COOKIE_SECURE,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -10,4 +10,40 @@ type AuthHandlersInterface interface {
 	GetUserByID(w http.ResponseWriter, r *http.Request)
 	LoginUser(w http.ResponseWriter, r *http.Request)
 	RefreshToken(w http.ResponseWriter, r *http.Request)
+	IntrospectToken(w http.ResponseWriter, r *http.Request)
+	RevokeToken(w http.ResponseWriter, r *http.Request)
+	VerifyEmail(w http.ResponseWriter, r *http.Request)
+	ResendVerificationEmail(w http.ResponseWriter, r *http.Request)
+	ForgotPassword(w http.ResponseWriter, r *http.Request)
+	ResetPassword(w http.ResponseWriter, r *http.Request)
+	ChangePassword(w http.ResponseWriter, r *http.Request)
+	RequestEmailChange(w http.ResponseWriter, r *http.Request)
+	ConfirmEmailChange(w http.ResponseWriter, r *http.Request)
+	CancelEmailChange(w http.ResponseWriter, r *http.Request)
+	UnlockAccount(w http.ResponseWriter, r *http.Request)
+	LoginMFA(w http.ResponseWriter, r *http.Request)
+	EnrollTOTP(w http.ResponseWriter, r *http.Request)
+	ConfirmTOTP(w http.ResponseWriter, r *http.Request)
+	DisableTOTP(w http.ResponseWriter, r *http.Request)
+	RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request)
+	BeginWebAuthnRegistration(w http.ResponseWriter, r *http.Request)
+	FinishWebAuthnRegistration(w http.ResponseWriter, r *http.Request)
+	BeginWebAuthnLogin(w http.ResponseWriter, r *http.Request)
+	FinishWebAuthnLogin(w http.ResponseWriter, r *http.Request)
+	GetWebAuthnCredentials(w http.ResponseWriter, r *http.Request)
+	DeleteWebAuthnCredential(w http.ResponseWriter, r *http.Request)
+	RequestMagicLink(w http.ResponseWriter, r *http.Request)
+	VerifyMagicLink(w http.ResponseWriter, r *http.Request)
+	RequestEmailOTP(w http.ResponseWriter, r *http.Request)
+	VerifyEmailOTP(w http.ResponseWriter, r *http.Request)
+}
+
+type WellKnownHandlersInterface interface {
+	JWKS(w http.ResponseWriter, r *http.Request)
+	OpenIDConfiguration(w http.ResponseWriter, r *http.Request)
+}
+
+type AdminHandlersInterface interface {
+	RevokeAccessToken(w http.ResponseWriter, r *http.Request)
+	UnlockUser(w http.ResponseWriter, r *http.Request)
 }
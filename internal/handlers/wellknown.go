@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/config"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/models"
+)
+
+type WellKnownHandlers struct{}
+
+func NewWellKnownHandlers() WellKnownHandlersInterface {
+	return &WellKnownHandlers{}
+}
+
+// JWKS publishes the public keys which verify our tokens as a JSON Web Key Set,
+// so other services can verify access tokens without holding the signing key.
+func (h *WellKnownHandlers) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	models.ResponseWithJSON(w, http.StatusOK, config.NewAppConfig().KeyRing.JWKS())
+}
+
+// OpenIDConfiguration publishes an OpenID style discovery document which points
+// verifiers to the issuer, the JWKS and the token endpoints.
+func (h *WellKnownHandlers) OpenIDConfiguration(w http.ResponseWriter, r *http.Request) {
+	issuer := config.Envs.JWT_ISSUER
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	models.ResponseWithJSON(w, http.StatusOK, &models.DiscoveryDocument{
+		Issuer:                      issuer,
+		JWKSURI:                     issuer + "/.well-known/jwks.json",
+		TokenEndpoint:               issuer + "/api/auth/login",
+		EndSessionEndpoint:          issuer + "/api/auth/logout",
+		IntrospectionEndpoint:       issuer + "/api/auth/introspect",
+		RevocationEndpoint:          issuer + "/api/auth/revoke",
+		AccessTokenSigningAlgValues: config.NewAppConfig().KeyRing.Algorithms(),
+	})
+}
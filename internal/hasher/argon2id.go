@@ -0,0 +1,86 @@
+package hasher
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2idHasher hashes passwords with Argon2id, in the PHC string format
+// "$argon2id$v=19$m=<memory KiB>,t=<time>,p=<threads>$<salt>$<key>" with unpadded base64.
+type Argon2idHasher struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+	keyLen  uint32
+	saltLen uint32
+}
+
+// argon2idParams are the parameters of an encoded Argon2id hash.
+type argon2idParams struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.time, h.memory, h.threads, h.keyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.memory, h.time, h.threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *Argon2idHasher) Verify(encodedHash string, password string) (bool, error) {
+	params, err := parseArgon2id(encodedHash)
+	if err != nil {
+		return false, err
+	}
+	key := argon2.IDKey([]byte(password), params.salt, params.time, params.memory, params.threads, uint32(len(params.key)))
+	return subtle.ConstantTimeCompare(key, params.key) == 1, nil
+}
+
+func (h *Argon2idHasher) NeedsRehash(encodedHash string) bool {
+	params, err := parseArgon2id(encodedHash)
+	return err != nil || params.time != h.time || params.memory != h.memory || params.threads != h.threads ||
+		uint32(len(params.key)) != h.keyLen || uint32(len(params.salt)) != h.saltLen
+}
+
+func (h *Argon2idHasher) matches(encodedHash string) bool {
+	return strings.HasPrefix(encodedHash, "$argon2id$")
+}
+
+// parseArgon2id decodes an Argon2id hash in the PHC string format.
+func parseArgon2id(encodedHash string) (*argon2idParams, error) {
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, fmt.Errorf("invalid argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2id version")
+	}
+	params := &argon2idParams{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return nil, fmt.Errorf("invalid argon2id parameters")
+	}
+	if params.time == 0 || params.threads == 0 {
+		return nil, fmt.Errorf("invalid argon2id parameters")
+	}
+	var err error
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("invalid argon2id salt")
+	}
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(params.key) == 0 {
+		return nil, fmt.Errorf("invalid argon2id key")
+	}
+	return params, nil
+}
@@ -0,0 +1,37 @@
+package hasher
+
+import (
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BcryptHasher hashes passwords with bcrypt, in the "$2a$<cost>$..." format.
+type BcryptHasher struct {
+	cost int
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h *BcryptHasher) Verify(encodedHash string, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encodedHash), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (h *BcryptHasher) NeedsRehash(encodedHash string) bool {
+	cost, err := bcrypt.Cost([]byte(encodedHash))
+	return err != nil || cost != h.cost
+}
+
+func (h *BcryptHasher) matches(encodedHash string) bool {
+	return strings.HasPrefix(encodedHash, "$2a$") || strings.HasPrefix(encodedHash, "$2b$") || strings.HasPrefix(encodedHash, "$2y$")
+}
@@ -0,0 +1,72 @@
+package hasher
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/config"
+)
+
+var (
+	hasherOnce sync.Once
+	hasher     PasswordHasherInterface
+)
+
+// PasswordHasherInterface hashes passwords into self-describing encoded hashes, which carry the algorithm
+// and its parameters, so hashes of older settings keep verifying after the settings change.
+type PasswordHasherInterface interface {
+	Hash(password string) (string, error)
+	Verify(encodedHash string, password string) (bool, error)
+	NeedsRehash(encodedHash string) bool
+}
+
+// algorithm is a single hashing algorithm, which recognises its own encoded hashes.
+type algorithm interface {
+	PasswordHasherInterface
+	matches(encodedHash string) bool
+}
+
+// NewPasswordHasher returns the singleton hasher selected by PASSWORD_HASHER, "argon2id" or "bcrypt".
+// New passwords are hashed with it, while hashes of both algorithms are verified.
+func NewPasswordHasher() PasswordHasherInterface {
+	hasherOnce.Do(func() {
+		bcryptHasher := &BcryptHasher{cost: config.Envs.BCRYPT_COST}
+		argon2idHasher := &Argon2idHasher{
+			time:    uint32(config.Envs.ARGON2_TIME),
+			memory:  uint32(config.Envs.ARGON2_MEMORY),
+			threads: uint8(config.Envs.ARGON2_THREADS),
+			keyLen:  32,
+			saltLen: 16,
+		}
+		var current algorithm = argon2idHasher
+		if config.Envs.PASSWORD_HASHER == "bcrypt" {
+			current = bcryptHasher
+		}
+		hasher = &PasswordHasher{current: current, algorithms: []algorithm{argon2idHasher, bcryptHasher}}
+	})
+	return hasher
+}
+
+// PasswordHasher hashes with the current algorithm and verifies with whichever algorithm produced a hash.
+type PasswordHasher struct {
+	current    algorithm
+	algorithms []algorithm
+}
+
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	return h.current.Hash(password)
+}
+
+func (h *PasswordHasher) Verify(encodedHash string, password string) (bool, error) {
+	for _, a := range h.algorithms {
+		if a.matches(encodedHash) {
+			return a.Verify(encodedHash, password)
+		}
+	}
+	return false, fmt.Errorf("unknown password hash format")
+}
+
+// NeedsRehash reports whether a hash was made with another algorithm or other parameters than the current ones.
+func (h *PasswordHasher) NeedsRehash(encodedHash string) bool {
+	return !h.current.matches(encodedHash) || h.current.NeedsRehash(encodedHash)
+}
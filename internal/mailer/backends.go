@@ -0,0 +1,73 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/config"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/utils"
+)
+
+// LogMailer writes emails to the application log instead of sending them.
+type LogMailer struct{}
+
+func (m *LogMailer) Send(ctx context.Context, msg *Message) error {
+	utils.Log.InfoContext(ctx, "email", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
+
+// FileMailer writes every email as a .eml file into a directory instead of sending it.
+type FileMailer struct {
+	dir string
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg *Message) error {
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), strings.NewReplacer("@", "_at_", "/", "_").Replace(msg.To))
+	err := os.WriteFile(filepath.Join(m.dir, name), formatMessage(config.Envs.MAILER_FROM, msg), 0600)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on writing email file", "function", "Send", "error", err)
+	}
+	return err
+}
+
+// SMTPMailer delivers emails through an SMTP server.
+type SMTPMailer struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg *Message) error {
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+	err := smtp.SendMail(m.addr, auth, m.from, []string{msg.To}, formatMessage(m.from, msg))
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on sending email", "function", "Send", "error", err)
+	}
+	return err
+}
+
+// formatMessage renders a message as a plain text RFC 5322 email.
+// Line breaks are removed from header values, so they can't inject headers.
+func formatMessage(from string, msg *Message) []byte {
+	header := strings.NewReplacer("\r", "", "\n", "")
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", header.Replace(from))
+	fmt.Fprintf(&b, "To: %s\r\n", header.Replace(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", header.Replace(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -0,0 +1,47 @@
+package mailer
+
+import (
+	"context"
+	"sync"
+
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/config"
+)
+
+var (
+	mailerOnce sync.Once
+	mailer     MailerInterface
+)
+
+type MailerInterface interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// NewMailer returns the singleton mailer selected by MAILER: "log" writes emails to the application log,
+// "file" writes every email as a file into MAILER_FILE_DIR, both meant for local testing, and "smtp"
+// delivers them through SMTP_HOST.
+func NewMailer() MailerInterface {
+	mailerOnce.Do(func() {
+		switch config.Envs.MAILER {
+		case "file":
+			mailer = &FileMailer{dir: config.Envs.MAILER_FILE_DIR}
+		case "smtp":
+			mailer = &SMTPMailer{
+				addr:     config.Envs.SMTP_HOST + ":" + config.Envs.SMTP_PORT,
+				host:     config.Envs.SMTP_HOST,
+				username: config.Envs.SMTP_USERNAME,
+				password: config.Envs.SMTP_PASSWORD,
+				from:     config.Envs.MAILER_FROM,
+			}
+		default:
+			mailer = &LogMailer{}
+		}
+	})
+	return mailer
+}
@@ -0,0 +1,86 @@
+package mailer
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/config"
+)
+
+// webLink returns a link to a page of the web app (WEB_URL) carrying the token as query parameter.
+func webLink(path string, token string) string {
+	return config.Envs.WEB_URL + path + "?token=" + url.QueryEscape(token)
+}
+
+// NewVerificationEmail asks the owner of a new account to confirm their email address.
+func NewVerificationEmail(to string, token string) *Message {
+	return &Message{
+		To:      to,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Please confirm that this is your email address by opening the link below:\n\n%s\n\nIf you didn't create an account, you can ignore this email.\n",
+			webLink("/verify-email", token)),
+	}
+}
+
+// NewPasswordResetEmail sends the link to choose a new password.
+func NewPasswordResetEmail(to string, token string) *Message {
+	return &Message{
+		To:      to,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your account. Open the link below to choose a new password:\n\n%s\n\nIf you didn't ask for this, you can ignore this email, your password stays unchanged.\n",
+			webLink("/reset-password", token)),
+	}
+}
+
+// NewEmailChangeEmail asks the owner of the new address to confirm an email change.
+func NewEmailChangeEmail(to string, token string) *Message {
+	return &Message{
+		To:      to,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf("Please confirm that you want to use this email address for your account by opening the link below:\n\n%s\n\nIf you didn't ask for this, you can ignore this email.\n",
+			webLink("/confirm-email", token)),
+	}
+}
+
+// NewEmailChangeNoticeEmail tells the owner of the old address about an email change and how to cancel it.
+func NewEmailChangeNoticeEmail(to string, newEmail string, token string) *Message {
+	return &Message{
+		To:      to,
+		Subject: "Your email address is being changed",
+		Body: fmt.Sprintf("Someone asked to change the email address of your account to %s.\n\nIf this wasn't you, open the link below to cancel the change and log out every session, then reset your password:\n\n%s\n",
+			newEmail, webLink("/cancel-email-change", token)),
+	}
+}
+
+// NewAccountLockedEmail tells the owner of an account that it was locked after too many failed logins
+// and sends a link to unlock it right away.
+func NewAccountLockedEmail(to string, token string, lockedFor time.Duration) *Message {
+	return &Message{
+		To:      to,
+		Subject: "Your account was locked",
+		Body: fmt.Sprintf("Your account was locked for %s after too many failed logins. If these were you, open the link below to unlock it now:\n\n%s\n\nIf they weren't you, someone may be guessing your password, consider changing it once you're logged in.\n",
+			lockedFor, webLink("/unlock-account", token)),
+	}
+}
+
+// NewMagicLinkEmail sends a link which logs the user in without a password. It only works in the browser
+// it was requested from.
+func NewMagicLinkEmail(to string, token string, validFor time.Duration) *Message {
+	return &Message{
+		To:      to,
+		Subject: "Your login link",
+		Body: fmt.Sprintf("Open the link below in the same browser you asked for it to log in. It works once and expires in %s:\n\n%s\n\nIf you didn't ask for this, you can ignore this email.\n",
+			validFor, webLink("/magic-login", token)),
+	}
+}
+
+// NewEmailOTPEmail sends a one-time passcode which logs the user in without a password.
+func NewEmailOTPEmail(to string, code string, validFor time.Duration) *Message {
+	return &Message{
+		To:      to,
+		Subject: "Your login code",
+		Body: fmt.Sprintf("Use the code below to log in. It works once and expires in %s:\n\n%s\n\nNever share this code with anyone. If you didn't ask for it, you can ignore this email.\n",
+			validFor, code),
+	}
+}
@@ -1,12 +1,17 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/webauthn"
+)
 
 type User struct {
-	ID        int       `json:"id"`
-	Email     string    `json:"email"`
-	Password  string    `json:"-"`
-	CreatedAt time.Time `json:"created_at"`
+	ID              int        `json:"id"`
+	Email           string     `json:"email"`
+	Password        string     `json:"-"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	CreatedAt       time.Time  `json:"created_at"`
 }
 
 type AuthReqBody struct {
@@ -14,7 +19,89 @@ type AuthReqBody struct {
 	Password string `json:"password"`
 }
 
+type EmailReqBody struct {
+	Email string `json:"email"`
+}
+
+type TokenReqBody struct {
+	Token string `json:"token"`
+}
+
+type ResetPasswordReqBody struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type ChangePasswordReqBody struct {
+	CurrentPassword      string `json:"current_password"`
+	NewPassword          string `json:"new_password"`
+	SignOutOtherSessions bool   `json:"sign_out_other_sessions"`
+}
+
+type ChangeEmailReqBody struct {
+	Password string `json:"password"`
+	NewEmail string `json:"new_email"`
+}
+
+// TokenResponse holds the tokens of a new session. When the user has two-factor authentication enabled,
+// a login only returns an MFAToken, which has to be exchanged for the tokens together with a code.
 type TokenResponse struct {
-	AccessToken  string `json:"access_token"`
+	AccessToken  string `json:"access_token,omitempty"`
 	RefreshToken string `json:"-"`
+	MFAToken     string `json:"mfa_token,omitempty"`
+}
+
+// MagicLinkResponse carries the nonce which binds a magic link to the browser that requested it.
+// It is only sent as a cookie.
+type MagicLinkResponse struct {
+	Nonce string `json:"-"`
+}
+
+type EmailOTPReqBody struct {
+	Email string `json:"email"`
+	Code  string `json:"code"`
+}
+
+type MFACodeReqBody struct {
+	Code string `json:"code"`
+}
+
+type MFALoginReqBody struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+type DisableMFAReqBody struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type TOTPEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type RevokeAccessTokenReqBody struct {
+	TokenID    string `json:"jti"`
+	ExpireTime int64  `json:"exp"`
+}
+
+type WebAuthnRegisterReqBody struct {
+	Name       string                              `json:"name"`
+	Credential webauthn.CredentialCreationResponse `json:"credential"`
+}
+
+type WebAuthnLoginReqBody struct {
+	Credential webauthn.CredentialAssertionResponse `json:"credential"`
+}
+
+type WebAuthnCredential struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
 }
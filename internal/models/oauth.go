@@ -0,0 +1,21 @@
+package models
+
+// Token type values of RFC 7009 (token_type_hint) and RFC 7662 (token_type).
+const (
+	ACCESS_TOKEN_TYPE_HINT  = "access_token"
+	REFRESH_TOKEN_TYPE_HINT = "refresh_token"
+)
+
+// IntrospectionResponse is the RFC 7662 token introspection response.
+// Inactive tokens only have active set to false.
+type IntrospectionResponse struct {
+	Active    bool     `json:"active"`
+	TokenType string   `json:"token_type,omitempty"`
+	ExpireAt  int64    `json:"exp,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  []string `json:"aud,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	TokenID   string   `json:"jti,omitempty"`
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 )
 
@@ -12,17 +13,36 @@ type Response struct {
 }
 
 type ErrorResponse struct {
-	Success bool   `json:"success"`
-	Status  int    `json:"status"`
-	Error   string `json:"error"`
+	Success bool        `json:"success"`
+	Status  int         `json:"status"`
+	Error   string      `json:"error"`
+	Fields  FieldErrors `json:"fields,omitempty"`
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// FieldErrors lists the invalid fields of a request body. It is an error, so every layer can return it,
+// and NewErrorResponse puts the single fields into the response.
+type FieldErrors []FieldError
+
+func (e FieldErrors) Error() string {
+	return "please check the invalid fields"
 }
 
 func NewErrorResponse(status int, err error) *ErrorResponse {
-	return &ErrorResponse{
+	res := &ErrorResponse{
 		Success: false,
 		Status:  status,
 		Error:   err.Error(),
 	}
+	var fields FieldErrors
+	if errors.As(err, &fields) {
+		res.Fields = fields
+	}
+	return res
 }
 
 func ResponseWithJSON(w http.ResponseWriter, status int, payload any) {
@@ -0,0 +1,14 @@
+package models
+
+// DiscoveryDocument is the OpenID style discovery document served at /.well-known/openid-configuration.
+// Besides registered metadata it carries the signing algorithms of our access tokens under a vendor
+// specific name, as no registered field describes them and we issue no ID tokens.
+type DiscoveryDocument struct {
+	Issuer                      string   `json:"issuer"`
+	JWKSURI                     string   `json:"jwks_uri"`
+	TokenEndpoint               string   `json:"token_endpoint"`
+	EndSessionEndpoint          string   `json:"end_session_endpoint"`
+	IntrospectionEndpoint       string   `json:"introspection_endpoint"`
+	RevocationEndpoint          string   `json:"revocation_endpoint"`
+	AccessTokenSigningAlgValues []string `json:"x_access_token_signing_alg_values_supported"`
+}
@@ -0,0 +1,117 @@
+package otp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 test vectors, "12345678901234567890", base32 encoded.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// rfcVectors are the SHA-1 test vectors of RFC 6238 appendix B, cut to the last 6 digits.
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{unix: 59, code: "287082"},
+	{unix: 1111111109, code: "081804"},
+	{unix: 1111111111, code: "050471"},
+	{unix: 1234567890, code: "005924"},
+	{unix: 2000000000, code: "279037"},
+	{unix: 20000000000, code: "353130"},
+}
+
+func TestCode(t *testing.T) {
+	for _, v := range rfcVectors {
+		code, err := Code(rfcSecret, Step(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != v.code {
+			t.Errorf("Code at %d = %s, want %s", v.unix, code, v.code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, v := range rfcVectors {
+		now := time.Unix(v.unix, 0)
+		step, ok := Validate(rfcSecret, v.code, now, 1)
+		if !ok || step != Step(now) {
+			t.Errorf("Validate(%s) at %d = %d, %v, want %d, true", v.code, v.unix, step, ok, Step(now))
+		}
+	}
+
+	now := time.Unix(1111111111, 0)
+	tests := []struct {
+		name   string
+		code   string
+		at     time.Time
+		skew   int
+		want   bool
+		offset int64
+	}{
+		{name: "previous step within skew", code: "050471", at: now.Add(Period), skew: 1, want: true, offset: -1},
+		{name: "next step within skew", code: "050471", at: now.Add(-Period), skew: 1, want: true, offset: 1},
+		{name: "previous step without skew", code: "050471", at: now.Add(Period), skew: 0},
+		{name: "outside skew", code: "050471", at: now.Add(2 * Period), skew: 1},
+		{name: "spaces", code: " 050 471 ", at: now, skew: 0, want: true},
+		{name: "wrong code", code: "050472", at: now, skew: 1},
+		{name: "too short", code: "05047", at: now, skew: 1},
+		{name: "too long", code: "0504710", at: now, skew: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, tt.code, tt.at, tt.skew)
+			if ok != tt.want {
+				t.Fatalf("Validate(%q) = %v, want %v", tt.code, ok, tt.want)
+			}
+			if ok && step != Step(tt.at)+tt.offset {
+				t.Errorf("got step %d, want %d", step, Step(tt.at)+tt.offset)
+			}
+		})
+	}
+
+	if _, ok := Validate("not base32!", "050471", now, 1); ok {
+		t.Error("code of an invalid secret validates")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := Code(secret, Step(time.Now()))
+	if err != nil {
+		t.Fatalf("generated secret doesn't decode: %v", err)
+	}
+	if _, ok := Validate(secret, code, time.Now(), 1); !ok {
+		t.Error("code of a generated secret doesn't validate")
+	}
+
+	other, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == secret {
+		t.Error("secrets repeat")
+	}
+}
+
+func TestURI(t *testing.T) {
+	u, err := url.Parse(URI("My App", "jane@example.com", rfcSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/My App:jane@example.com" {
+		t.Errorf("got %s", u)
+	}
+	query := u.Query()
+	for key, want := range map[string]string{"secret": rfcSecret, "issuer": "My App", "algorithm": "SHA1", "digits": "6", "period": "30"} {
+		if got := query.Get(key); got != want {
+			t.Errorf("got %s=%q, want %q", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/utils"
+)
+
+const (
+	INSERT_RATE_LIMIT           = `INSERT IGNORE INTO rate_limits (bucket_key, tokens, updated_at, expire_time) VALUES (?, ?, ?, ?)`
+	FETCH_RATE_LIMIT_FOR_UPDATE = `SELECT tokens, updated_at FROM rate_limits WHERE bucket_key = ? FOR UPDATE`
+	UPDATE_RATE_LIMIT           = `UPDATE rate_limits SET tokens = ?, updated_at = ?, expire_time = ? WHERE bucket_key = ?`
+	DELETE_EXPIRED_RATE_LIMITS  = `DELETE FROM rate_limits WHERE expire_time <= ?`
+)
+
+// DBStore keeps the token buckets in the rate_limits table, so the limits hold across instances.
+// updated_at is in Unix milliseconds, expire_time is the Unix time when the bucket is full again.
+type DBStore struct {
+	db *sql.DB
+}
+
+func newDBStore(db *sql.DB) *DBStore {
+	s := &DBStore{db: db}
+	go purgeBuckets(s.purge)
+	return s
+}
+
+// Take takes a token from the bucket of a key. The row is locked while it is updated,
+// so concurrent requests of every instance are all counted.
+func (s *DBStore) Take(ctx context.Context, key string, policy *Policy) (*Result, error) {
+	now := time.Now()
+	if _, err := s.db.ExecContext(ctx, INSERT_RATE_LIMIT, key, policy.Limit, now.UnixMilli(), now.Unix()); err != nil {
+		utils.Log.ErrorContext(ctx, "error on saving rate limit", "function", "Take", "error", err)
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on starting transaction", "function", "Take", "error", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	b := &bucket{}
+	var updatedAt int64
+	if err := tx.QueryRowContext(ctx, FETCH_RATE_LIMIT_FOR_UPDATE, key).Scan(&b.tokens, &updatedAt); err != nil {
+		utils.Log.ErrorContext(ctx, "error on fetching rate limit", "function", "Take", "error", err)
+		return nil, err
+	}
+	b.updated = time.UnixMilli(updatedAt)
+	res := b.take(policy, now)
+	if _, err := tx.ExecContext(ctx, UPDATE_RATE_LIMIT, b.tokens, b.updated.UnixMilli(), b.fullAt(policy).Unix()+1, key); err != nil {
+		utils.Log.ErrorContext(ctx, "error on saving rate limit", "function", "Take", "error", err)
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		utils.Log.ErrorContext(ctx, "error on saving rate limit", "function", "Take", "error", err)
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *DBStore) purge(ctx context.Context, now time.Time) error {
+	_, err := s.db.ExecContext(ctx, DELETE_EXPIRED_RATE_LIMITS, now.Unix())
+	return err
+}
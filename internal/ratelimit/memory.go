@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps the token buckets in memory, the limits only hold per instance.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+}
+
+type memoryBucket struct {
+	bucket
+	fullAt time.Time
+}
+
+func newMemoryStore() *MemoryStore {
+	s := &MemoryStore{buckets: map[string]*memoryBucket{}}
+	go purgeBuckets(s.purge)
+	return s
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, policy *Policy) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &memoryBucket{bucket: bucket{tokens: float64(policy.Limit), updated: now}}
+		s.buckets[key] = b
+	}
+	res := b.take(policy, now)
+	b.fullAt = b.bucket.fullAt(policy)
+	return res, nil
+}
+
+func (s *MemoryStore) purge(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, b := range s.buckets {
+		if !b.fullAt.After(now) {
+			delete(s.buckets, key)
+		}
+	}
+	return nil
+}
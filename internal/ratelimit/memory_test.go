@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBucketBurstAndRefill(t *testing.T) {
+	// 10 requests per minute refill a token every 6 seconds.
+	policy := &Policy{Name: "test", Limit: 10, Period: time.Minute}
+	now := time.Unix(1700000000, 0)
+	b := &bucket{tokens: float64(policy.Limit), updated: now}
+
+	// A full bucket allows a burst of Limit requests.
+	for i := 0; i < policy.Limit; i++ {
+		res := b.take(policy, now)
+		if !res.Allowed || res.Remaining != policy.Limit-i-1 {
+			t.Fatalf("request %d: got %+v", i+1, res)
+		}
+	}
+	res := b.take(policy, now)
+	if res.Allowed || res.Remaining != 0 {
+		t.Fatalf("request over the burst: got %+v", res)
+	}
+	if res.RetryAfter != 6*time.Second || res.Reset != time.Minute {
+		t.Errorf("got retry after %s and reset %s, want 6s and 1m", res.RetryAfter, res.Reset)
+	}
+
+	// Half a token isn't enough yet.
+	res = b.take(policy, now.Add(3*time.Second))
+	if res.Allowed || res.RetryAfter != 3*time.Second {
+		t.Errorf("after 3s: got %+v", res)
+	}
+	res = b.take(policy, now.Add(6*time.Second))
+	if !res.Allowed || res.Remaining != 0 {
+		t.Errorf("after 6s: got %+v", res)
+	}
+
+	// The bucket never refills beyond Limit.
+	res = b.take(policy, now.Add(time.Hour))
+	if !res.Allowed || res.Remaining != policy.Limit-1 {
+		t.Errorf("after an hour: got %+v", res)
+	}
+	if full := b.fullAt(policy); !full.Equal(now.Add(time.Hour + 6*time.Second)) {
+		t.Errorf("full at %s", full)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	s := &MemoryStore{buckets: map[string]*memoryBucket{}}
+	policy := &Policy{Name: "test", Limit: 2, Period: time.Hour}
+
+	for i := 0; i < policy.Limit; i++ {
+		if res, err := s.Take(ctx, "a", policy); err != nil || !res.Allowed {
+			t.Fatalf("request %d: got %+v, %v", i+1, res, err)
+		}
+	}
+	if res, _ := s.Take(ctx, "a", policy); res.Allowed {
+		t.Error("request over the limit was allowed")
+	}
+	// Every key has its own bucket.
+	if res, _ := s.Take(ctx, "b", policy); !res.Allowed {
+		t.Error("request of another key was refused")
+	}
+
+	// Buckets are kept until they are full again.
+	if err := s.purge(ctx, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.buckets) != 2 {
+		t.Fatalf("got %d buckets after an early purge, want 2", len(s.buckets))
+	}
+	if err := s.purge(ctx, time.Now().Add(policy.Period)); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.buckets) != 0 {
+		t.Errorf("got %d buckets after the period, want 0", len(s.buckets))
+	}
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/config"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/utils"
+)
+
+var (
+	storeOnce sync.Once
+	store     StoreInterface
+)
+
+// StoreInterface keeps the token buckets of the rate limits.
+type StoreInterface interface {
+	// Take takes a token from the bucket of a key, creating a full bucket for new keys.
+	Take(ctx context.Context, key string, policy *Policy) (*Result, error)
+}
+
+// Policy is a token bucket policy: a bucket holds up to Limit tokens, every request takes one,
+// and an empty bucket is refilled over Period, e.g. 10 requests per minute with bursts of up to 10.
+type Policy struct {
+	Name   string
+	Limit  int
+	Period time.Duration
+}
+
+// Result is the outcome of taking a token from a bucket.
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next token is available, 0 if the request was allowed.
+	RetryAfter time.Duration
+}
+
+// bucket is the state of a token bucket, tokens is fractional as the bucket refills continuously.
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewStore returns the singleton rate limit store selected by RATE_LIMIT_STORE:
+// "memory" keeps the buckets in the process, "db" keeps them in the rate_limits table so the
+// limits hold across every instance of a multi-instance deployment.
+func NewStore() StoreInterface {
+	storeOnce.Do(func() {
+		switch config.Envs.RATE_LIMIT_STORE {
+		case "db":
+			store = newDBStore(config.NewAppConfig().DB)
+		default:
+			store = newMemoryStore()
+		}
+	})
+	return store
+}
+
+// take refills a bucket for the time passed since its last update and takes a token if one is available.
+func (b *bucket) take(policy *Policy, now time.Time) *Result {
+	rate := float64(policy.Limit) / policy.Period.Seconds()
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(policy.Limit), b.tokens+elapsed*rate)
+	}
+	b.updated = now
+
+	res := &Result{}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = seconds((float64(policy.Limit) - b.tokens) / rate)
+	return res
+}
+
+// fullAt returns when a bucket is full again, after which it doesn't need to be kept.
+func (b *bucket) fullAt(policy *Policy) time.Time {
+	rate := float64(policy.Limit) / policy.Period.Seconds()
+	return b.updated.Add(seconds((float64(policy.Limit) - b.tokens) / rate))
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// purgeBuckets drops the buckets which are full again once a minute, a full bucket
+// behaves the same as a bucket which doesn't exist.
+func purgeBuckets(purge func(ctx context.Context, now time.Time) error) {
+	ticker := time.NewTicker(time.Minute)
+	for range ticker.C {
+		if err := purge(context.Background(), time.Now()); err != nil {
+			utils.Log.Error("error on purging rate limits", "function", "purgeBuckets", "error", err)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/config"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/utils"
+)
+
+const (
+	INSERT_ATTEMPT_KEY        = `INSERT IGNORE INTO auth_attempts (attempt_key) VALUES (?)`
+	FETCH_ATTEMPTS            = `SELECT failures, blocked_until, expire_time FROM auth_attempts WHERE attempt_key = ?`
+	FETCH_ATTEMPTS_FOR_UPDATE = `SELECT failures, blocked_until, expire_time FROM auth_attempts WHERE attempt_key = ? FOR UPDATE`
+	UPDATE_ATTEMPTS           = `UPDATE auth_attempts SET failures = ?, blocked_until = ?, expire_time = ? WHERE attempt_key = ?`
+	DELETE_ATTEMPTS           = `DELETE FROM auth_attempts WHERE attempt_key = ?`
+	DELETE_EXPIRED_ATTEMPTS   = `DELETE FROM auth_attempts WHERE expire_time <= ?`
+)
+
+var (
+	attemptOnce  sync.Once
+	attemptStore AttemptStoreInterface
+)
+
+// Attempts are the recent failed attempts of a key, e.g. the logins of an account or of an IP address.
+type Attempts struct {
+	Failures int
+	// BlockedUntil is the Unix time until which no further attempt is allowed, 0 if none.
+	BlockedUntil int64
+	// expireTime is the Unix time when the failures are forgotten.
+	expireTime int64
+}
+
+// IsBlocked reports whether attempts are refused at the given time.
+func (a *Attempts) IsBlocked(now time.Time) bool {
+	return a.BlockedUntil > now.Unix()
+}
+
+// AttemptPolicy decides how long a key is blocked after a failed attempt: the first BackoffAfter failures
+// are free, every further failure doubles the delay starting at BackoffBase up to BackoffMax, and
+// LockoutThreshold failures lock the key for LockoutDuration. Failures are forgotten once Window passed
+// since the last failure and no block is left.
+type AttemptPolicy struct {
+	Window           time.Duration
+	BackoffAfter     int
+	BackoffBase      time.Duration
+	BackoffMax       time.Duration
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+}
+
+// apply records one more failure at the given time.
+func (p *AttemptPolicy) apply(a *Attempts, now time.Time) {
+	if a.expireTime <= now.Unix() {
+		a.Failures = 0
+	}
+	a.Failures++
+
+	a.BlockedUntil = 0
+	switch {
+	case p.LockoutThreshold > 0 && a.Failures >= p.LockoutThreshold:
+		a.BlockedUntil = now.Add(p.LockoutDuration).Unix()
+	case a.Failures > p.BackoffAfter:
+		delay := p.BackoffBase
+		for i := p.BackoffAfter + 1; i < a.Failures && delay < p.BackoffMax; i++ {
+			delay *= 2
+		}
+		a.BlockedUntil = now.Add(min(delay, p.BackoffMax)).Unix()
+	}
+	a.expireTime = max(now.Add(p.Window).Unix(), a.BlockedUntil)
+}
+
+// IsLockedOut reports whether the attempts reached the lockout, rather than only a backoff delay.
+func (p *AttemptPolicy) IsLockedOut(a *Attempts) bool {
+	return p.LockoutThreshold > 0 && a.Failures >= p.LockoutThreshold
+}
+
+// NewAttemptStore returns the singleton failed attempt store selected by ATTEMPT_STORE:
+// "memory" keeps the counters in the process, "db" keeps them in the auth_attempts table so every
+// instance of a multi-instance deployment sees them.
+func NewAttemptStore() AttemptStoreInterface {
+	attemptOnce.Do(func() {
+		switch config.Envs.ATTEMPT_STORE {
+		case "db":
+			attemptStore = newDBAttemptStore(config.NewAppConfig().DB)
+		default:
+			attemptStore = newMemoryAttemptStore()
+		}
+	})
+	return attemptStore
+}
+
+// MemoryAttemptStore keeps failed attempts in memory.
+type MemoryAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]Attempts
+}
+
+func newMemoryAttemptStore() *MemoryAttemptStore {
+	s := &MemoryAttemptStore{attempts: map[string]Attempts{}}
+	go purgeAttempts(s.purge)
+	return s
+}
+
+// Get returns the recent failed attempts of a key.
+func (s *MemoryAttemptStore) Get(ctx context.Context, key string) (*Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.attempts[key]
+	if a.expireTime <= time.Now().Unix() {
+		return &Attempts{}, nil
+	}
+	return &a, nil
+}
+
+// Fail records a failed attempt of a key and blocks it according to the policy.
+func (s *MemoryAttemptStore) Fail(ctx context.Context, key string, policy *AttemptPolicy) (*Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.attempts[key]
+	policy.apply(&a, time.Now())
+	s.attempts[key] = a
+	return &a, nil
+}
+
+// Reset forgets the failed attempts of a key.
+func (s *MemoryAttemptStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
+
+func (s *MemoryAttemptStore) purge(ctx context.Context, now int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, a := range s.attempts {
+		if a.expireTime <= now {
+			delete(s.attempts, key)
+		}
+	}
+	return nil
+}
+
+// DBAttemptStore keeps failed attempts in the auth_attempts table.
+type DBAttemptStore struct {
+	db *sql.DB
+}
+
+func newDBAttemptStore(db *sql.DB) *DBAttemptStore {
+	s := &DBAttemptStore{db: db}
+	go purgeAttempts(s.purge)
+	return s
+}
+
+// Get returns the recent failed attempts of a key.
+func (s *DBAttemptStore) Get(ctx context.Context, key string) (*Attempts, error) {
+	a := &Attempts{}
+	err := s.db.QueryRowContext(ctx, FETCH_ATTEMPTS, key).Scan(&a.Failures, &a.BlockedUntil, &a.expireTime)
+	if err != nil && err != sql.ErrNoRows {
+		utils.Log.ErrorContext(ctx, "error on fetching attempts", "function", "Get", "error", err)
+		return nil, err
+	}
+	if a.expireTime <= time.Now().Unix() {
+		return &Attempts{}, nil
+	}
+	return a, nil
+}
+
+// Fail records a failed attempt of a key and blocks it according to the policy.
+// The row is locked while it is updated, so concurrent failures are all counted.
+func (s *DBAttemptStore) Fail(ctx context.Context, key string, policy *AttemptPolicy) (*Attempts, error) {
+	if _, err := s.db.ExecContext(ctx, INSERT_ATTEMPT_KEY, key); err != nil {
+		utils.Log.ErrorContext(ctx, "error on saving attempts", "function", "Fail", "error", err)
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on starting transaction", "function", "Fail", "error", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	a := &Attempts{}
+	err = tx.QueryRowContext(ctx, FETCH_ATTEMPTS_FOR_UPDATE, key).Scan(&a.Failures, &a.BlockedUntil, &a.expireTime)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on fetching attempts", "function", "Fail", "error", err)
+		return nil, err
+	}
+	policy.apply(a, time.Now())
+	if _, err := tx.ExecContext(ctx, UPDATE_ATTEMPTS, a.Failures, a.BlockedUntil, a.expireTime, key); err != nil {
+		utils.Log.ErrorContext(ctx, "error on saving attempts", "function", "Fail", "error", err)
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		utils.Log.ErrorContext(ctx, "error on saving attempts", "function", "Fail", "error", err)
+		return nil, err
+	}
+	return a, nil
+}
+
+// Reset forgets the failed attempts of a key.
+func (s *DBAttemptStore) Reset(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, DELETE_ATTEMPTS, key)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on deleting attempts", "function", "Reset", "error", err)
+	}
+	return err
+}
+
+func (s *DBAttemptStore) purge(ctx context.Context, now int64) error {
+	_, err := s.db.ExecContext(ctx, DELETE_EXPIRED_ATTEMPTS, now)
+	return err
+}
+
+// purgeAttempts drops the attempts which are forgotten anyway once a minute.
+func purgeAttempts(purge func(ctx context.Context, now int64) error) {
+	ticker := time.NewTicker(time.Minute)
+	for range ticker.C {
+		if err := purge(context.Background(), time.Now().Unix()); err != nil {
+			utils.Log.Error("error on purging attempts", "function", "purgeAttempts", "error", err)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newTestAttemptPolicy() *AttemptPolicy {
+	return &AttemptPolicy{
+		Window:           time.Minute,
+		BackoffAfter:     3,
+		BackoffBase:      time.Second,
+		BackoffMax:       8 * time.Second,
+		LockoutThreshold: 10,
+		LockoutDuration:  15 * time.Minute,
+	}
+}
+
+func TestAttemptPolicyBackoffAndLockout(t *testing.T) {
+	policy := newTestAttemptPolicy()
+	now := time.Unix(1700000000, 0)
+	// The block after each failure: free, then doubling from BackoffBase up to BackoffMax, then the lockout.
+	want := []time.Duration{0, 0, 0, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 8 * time.Second, 8 * time.Second, 15 * time.Minute}
+	a := &Attempts{}
+	for i, delay := range want {
+		policy.apply(a, now)
+		if a.Failures != i+1 {
+			t.Fatalf("got %d failures, want %d", a.Failures, i+1)
+		}
+		wantBlockedUntil := int64(0)
+		if delay != 0 {
+			wantBlockedUntil = now.Add(delay).Unix()
+		}
+		if a.BlockedUntil != wantBlockedUntil {
+			t.Errorf("failure %d: blocked until %d, want %d", i+1, a.BlockedUntil, wantBlockedUntil)
+		}
+		if blocked := a.IsBlocked(now); blocked != (delay != 0) {
+			t.Errorf("failure %d: IsBlocked = %v", i+1, blocked)
+		}
+		if locked := policy.IsLockedOut(a); locked != (i+1 >= policy.LockoutThreshold) {
+			t.Errorf("failure %d: IsLockedOut = %v", i+1, locked)
+		}
+	}
+	if a.IsBlocked(now.Add(policy.LockoutDuration)) {
+		t.Error("still blocked once the lockout is over")
+	}
+}
+
+func TestAttemptPolicyWindow(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       func(p *AttemptPolicy)
+		failures     int
+		after        time.Duration
+		wantFailures int
+	}{
+		{name: "within the window", failures: 3, after: 59 * time.Second, wantFailures: 4},
+		{name: "after the window", failures: 3, after: time.Minute, wantFailures: 1},
+		// The failures outlive the window as long as the lockout lasts.
+		{name: "during the lockout", failures: 10, after: 14 * time.Minute, wantFailures: 11},
+		{name: "after the lockout", failures: 10, after: 15 * time.Minute, wantFailures: 1},
+		{name: "without lockout", policy: func(p *AttemptPolicy) { p.LockoutThreshold = 0 }, failures: 10, after: time.Minute, wantFailures: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := newTestAttemptPolicy()
+			if tt.policy != nil {
+				tt.policy(policy)
+			}
+			now := time.Unix(1700000000, 0)
+			a := &Attempts{}
+			for i := 0; i < tt.failures; i++ {
+				policy.apply(a, now)
+			}
+			policy.apply(a, now.Add(tt.after))
+			if a.Failures != tt.wantFailures {
+				t.Errorf("got %d failures, want %d", a.Failures, tt.wantFailures)
+			}
+		})
+	}
+}
+
+func TestAttemptPolicyWithoutLockout(t *testing.T) {
+	policy := newTestAttemptPolicy()
+	policy.LockoutThreshold = 0
+	now := time.Unix(1700000000, 0)
+	a := &Attempts{}
+	for i := 0; i < 50; i++ {
+		policy.apply(a, now)
+	}
+	if policy.IsLockedOut(a) {
+		t.Error("locked out without a lockout threshold")
+	}
+	if a.BlockedUntil != now.Add(policy.BackoffMax).Unix() {
+		t.Errorf("blocked until %d, want the maximum backoff", a.BlockedUntil)
+	}
+}
+
+func TestMemoryAttemptStore(t *testing.T) {
+	ctx := context.Background()
+	store := &MemoryAttemptStore{attempts: map[string]Attempts{}}
+	policy := newTestAttemptPolicy()
+
+	for i := 0; i < policy.LockoutThreshold; i++ {
+		if _, err := store.Fail(ctx, "user:1", policy); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, err := store.Get(ctx, "user:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.IsBlocked(time.Now()) || !policy.IsLockedOut(a) {
+		t.Errorf("got %+v, want a locked out key", a)
+	}
+	if other, _ := store.Get(ctx, "user:2"); other.Failures != 0 {
+		t.Errorf("got %d failures of another key", other.Failures)
+	}
+
+	if err := store.Reset(ctx, "user:1"); err != nil {
+		t.Fatal(err)
+	}
+	if a, _ := store.Get(ctx, "user:1"); a.Failures != 0 || a.IsBlocked(time.Now()) {
+		t.Errorf("got %+v after reset", a)
+	}
+
+	// Expired failures are forgotten by Get and dropped by purge.
+	store.attempts["user:3"] = Attempts{Failures: 2, expireTime: time.Now().Add(-time.Second).Unix()}
+	if a, _ := store.Get(ctx, "user:3"); a.Failures != 0 {
+		t.Errorf("got %d expired failures", a.Failures)
+	}
+	store.purge(ctx, time.Now().Unix())
+	if _, ok := store.attempts["user:3"]; ok {
+		t.Error("expired failures weren't purged")
+	}
+}
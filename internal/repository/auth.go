@@ -2,52 +2,70 @@ package repository
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
-	"github.com/go-chi/jwtauth/v5"
+	"github.com/lestrrat-go/jwx/v2/jwt"
 	"github.com/the-arcade-01/golang-jwt-authentication/internal/config"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/hasher"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/mailer"
 	"github.com/the-arcade-01/golang-jwt-authentication/internal/models"
 	"github.com/the-arcade-01/golang-jwt-authentication/internal/utils"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/webauthn"
 )
 
 const (
 	INSERT_USER                = `INSERT INTO users (email, password) VALUES (?,?)`
 	COUNT_USER_BY_EMAIL        = `SELECT count(email) FROM users WHERE email = ?`
-	FETCH_USER_BY_EMAIL        = `SELECT id, email, password FROM users WHERE email = ?`
-	DELETE_TOKEN_REFRESH_TABLE = `DELETE from refresh_tokens_table WHERE user_id = ?`
-	FETCH_USER                 = `SELECT id, email, created_at FROM users WHERE id = ?`
-	FETCH_REFRESH_TOKEN        = `SELECT refresh_token FROM refresh_tokens_table WHERE user_id = ?`
+	FETCH_USER_BY_EMAIL        = `SELECT id, email, password, email_verified_at FROM users WHERE email = ?`
+	DELETE_TOKEN_REFRESH_TABLE = `DELETE from refresh_tokens_table WHERE session_id = ? AND user_id = ?`
+	DELETE_USER_SESSIONS       = `DELETE from refresh_tokens_table WHERE user_id = ?`
+	DELETE_OTHER_USER_SESSIONS = `DELETE from refresh_tokens_table WHERE user_id = ? AND session_id <> ?`
+	FETCH_USER_SESSION_IDS     = `SELECT session_id FROM refresh_tokens_table WHERE user_id = ? AND session_id <> ?`
+	FETCH_USER                 = `SELECT id, email, email_verified_at, created_at FROM users WHERE id = ?`
+	FETCH_REFRESH_TOKEN        = `SELECT refresh_token FROM refresh_tokens_table WHERE session_id = ? AND user_id = ?`
 	INSERT_REFRESH_TOKEN       = `
-		INSERT INTO refresh_tokens_table (user_id, refresh_token, expire_time) 
-		VALUES (?, ?, ?) 
-		ON DUPLICATE KEY UPDATE 
-		refresh_token = VALUES(refresh_token), 
-		expire_time = VALUES(expire_time), 
-		created_at = CURRENT_TIMESTAMP
+		INSERT INTO refresh_tokens_table (session_id, user_id, refresh_token, expire_time) 
+		VALUES (?, ?, ?, ?)
+	`
+	ROTATE_REFRESH_TOKEN = `
+		UPDATE refresh_tokens_table 
+		SET refresh_token = ?, expire_time = ? 
+		WHERE session_id = ? AND user_id = ? AND refresh_token = ?
 	`
 	DELETE_USER = `DELETE FROM users WHERE id = ?`
 )
 
 type AuthRepo struct {
-	db   *sql.DB
-	auth *jwtauth.JWTAuth
+	db           *sql.DB
+	auth         *config.KeyRing
+	revoked      RevocationStoreInterface
+	attempts     AttemptStoreInterface
+	mailer       mailer.MailerInterface
+	relyingParty webauthn.RelyingPartyInterface
 }
 
 func NewAuthRepo() AuthRepositoryInterface {
 	return &AuthRepo{
-		db:   config.NewAppConfig().DB,
-		auth: config.NewAppConfig().JWTAuth,
+		db:           config.NewAppConfig().DB,
+		auth:         config.NewAppConfig().KeyRing,
+		revoked:      NewRevocationStore(),
+		attempts:     NewAttemptStore(),
+		mailer:       mailer.NewMailer(),
+		relyingParty: webauthn.NewRelyingParty(),
 	}
 }
 
 // CreateUser creates a new user in the database.
 // It first checks if a user with the given email already exists.
 // If the email is already taken, it returns a BadRequest status with an appropriate error message.
-// If the email is not taken, it hashes the user's password and saves the user in the database.
+// If the email is not taken, it hashes the user's password, saves the user in the database and
+// emails a link to verify the email address.
 // It returns an OK status if the user is successfully created, or an InternalServerError status if there is an error during the process.
 //
 // Parameters:
@@ -58,14 +76,12 @@ func NewAuthRepo() AuthRepositoryInterface {
 //   - int: The HTTP status code indicating the result of the operation.
 //   - error: An error message if there was an issue during the operation.
 func (r *AuthRepo) CreateUser(ctx context.Context, user *models.User) (int, error) {
-	var row int
-	err := r.db.QueryRowContext(ctx, COUNT_USER_BY_EMAIL, user.Email).Scan(&row)
-	if err != nil && err != sql.ErrNoRows {
-		utils.Log.ErrorContext(ctx, "error fetching user", "function", "Create", "error", err)
+	taken, err := r.isEmailTaken(ctx, user.Email)
+	if err != nil {
 		return http.StatusInternalServerError, fmt.Errorf("please try again later")
 	}
 
-	if row != 0 {
+	if taken {
 		return http.StatusBadRequest, fmt.Errorf("email already taken, please use different email")
 	}
 
@@ -75,34 +91,119 @@ func (r *AuthRepo) CreateUser(ctx context.Context, user *models.User) (int, erro
 		return http.StatusInternalServerError, fmt.Errorf("please try again later")
 	}
 
-	_, err = r.db.ExecContext(ctx, INSERT_USER, user.Email, hashPassword)
+	res, err := r.db.ExecContext(ctx, INSERT_USER, user.Email, hashPassword)
 	if err != nil {
 		utils.Log.ErrorContext(ctx, "error on saving user in db", "function", "Create", "error", err)
 		return http.StatusInternalServerError, fmt.Errorf("please try again later")
 	}
 
+	// The account exists at this point, if the email can't be sent the user can ask for it again.
+	userID, err := res.LastInsertId()
+	if err == nil {
+		err = r.sendVerificationEmail(ctx, int(userID), user.Email)
+	}
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on sending verification email", "function", "Create", "error", err)
+	}
+
 	return http.StatusOK, nil
 }
 
-// LogoutUser logs out a user by deleting their refresh token from the database.
-// It takes a context and a userID as parameters and returns an HTTP status code and an error.
+// isEmailTaken reports whether an account with the given email address exists.
+func (r *AuthRepo) isEmailTaken(ctx context.Context, email string) (bool, error) {
+	var row int
+	err := r.db.QueryRowContext(ctx, COUNT_USER_BY_EMAIL, email).Scan(&row)
+	if err != nil && err != sql.ErrNoRows {
+		utils.Log.ErrorContext(ctx, "error fetching user", "function", "isEmailTaken", "error", err)
+		return false, err
+	}
+	return row != 0, nil
+}
+
+// LogoutUser logs out a single session of a user by deleting its refresh token from the database
+// and revoking the access token the request was made with together with every other access token of the session.
+// Other sessions of the same user (e.g. on a different device) stay logged in.
+// It takes a context, a userID, a sessionID and the access token's ID and expiration time as parameters
+// and returns an HTTP status code and an error.
 //
 // Parameters:
 //   - ctx: The context for the request, used for timeout and cancellation.
 //   - userID: The ID of the user to log out.
+//   - sessionID: The ID of the session to end.
+//   - accessTokenID: The jti of the access token to revoke.
+//   - accessTokenExpire: The expiration time of the access token in Unix time format.
 //
 // Returns:
 //   - int: HTTP status code indicating the result of the operation.
 //   - error: An error message if the operation fails, otherwise nil.
-func (r *AuthRepo) LogoutUser(ctx context.Context, userID int) (int, error) {
-	_, err := r.db.ExecContext(ctx, DELETE_TOKEN_REFRESH_TABLE, userID)
+func (r *AuthRepo) LogoutUser(ctx context.Context, userID int, sessionID string, accessTokenID string, accessTokenExpire int64) (int, error) {
+	_, err := r.db.ExecContext(ctx, DELETE_TOKEN_REFRESH_TABLE, sessionID, userID)
 	if err != nil {
 		utils.Log.ErrorContext(ctx, "error on deleting from refresh_tokens_table", "function", "Logout", "error", err)
 		return http.StatusInternalServerError, fmt.Errorf("please try again later")
 	}
+	if err := r.revokeSession(ctx, sessionID); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	return r.RevokeAccessToken(ctx, accessTokenID, accessTokenExpire)
+}
+
+// RevokeAccessToken puts an access token on the revocation denylist until it expires,
+// so it is refused before its exp even though its signature is still valid.
+//
+// Parameters:
+//   - ctx: The context for the request, used for timeout and cancellation.
+//   - accessTokenID: The jti of the access token to revoke.
+//   - accessTokenExpire: The expiration time of the access token in Unix time format.
+//
+// Returns:
+//   - int: HTTP status code indicating the result of the operation.
+//   - error: An error message if the operation fails, otherwise nil.
+func (r *AuthRepo) RevokeAccessToken(ctx context.Context, accessTokenID string, accessTokenExpire int64) (int, error) {
+	if err := r.revoked.Revoke(ctx, accessTokenID, accessTokenExpire); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
 	return http.StatusOK, nil
 }
 
+// revokeSession puts a session on the revocation denylist for as long as an access token issued for it
+// can be valid, so the access tokens of the session are refused together with its refresh token.
+func (r *AuthRepo) revokeSession(ctx context.Context, sessionID string) error {
+	accessTokenExpire := time.Now().Add(time.Duration(config.Envs.HTTP_ACCESS_TOKEN_EXPIRE) * time.Minute).Unix()
+	return r.revoked.Revoke(ctx, RevokedSessionKey(sessionID), accessTokenExpire)
+}
+
+// revokeUserSessions puts every session of a user except exceptSessionID on the revocation denylist.
+// It has to run before the sessions are deleted, as their IDs are looked up in refresh_tokens_table.
+func (r *AuthRepo) revokeUserSessions(ctx context.Context, userID int, exceptSessionID string) error {
+	rows, err := r.db.QueryContext(ctx, FETCH_USER_SESSION_IDS, userID, exceptSessionID)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on fetching from refresh_tokens_table", "function", "revokeUserSessions", "error", err)
+		return err
+	}
+	defer rows.Close()
+
+	var sessionIDs []string
+	for rows.Next() {
+		var sessionID string
+		if err := rows.Scan(&sessionID); err != nil {
+			utils.Log.ErrorContext(ctx, "error on scanning session id", "function", "revokeUserSessions", "error", err)
+			return err
+		}
+		sessionIDs = append(sessionIDs, sessionID)
+	}
+	if err := rows.Err(); err != nil {
+		utils.Log.ErrorContext(ctx, "error on fetching from refresh_tokens_table", "function", "revokeUserSessions", "error", err)
+		return err
+	}
+	for _, sessionID := range sessionIDs {
+		if err := r.revokeSession(ctx, sessionID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // GetUserByID retrieves a user from the database by their user ID.
 // It takes a context and a user ID as parameters and returns a pointer to a User model,
 // an HTTP status code, and an error if any occurred during the process.
@@ -121,7 +222,7 @@ func (r *AuthRepo) LogoutUser(ctx context.Context, userID int) (int, error) {
 //     an error is logged and a generic error message is returned with an HTTP 500 status code.
 func (r *AuthRepo) GetUserByID(ctx context.Context, userID int) (*models.User, int, error) {
 	user := &models.User{}
-	err := r.db.QueryRowContext(ctx, FETCH_USER, userID).Scan(&user.ID, &user.Email, &user.CreatedAt)
+	err := r.db.QueryRowContext(ctx, FETCH_USER, userID).Scan(&user.ID, &user.Email, &user.EmailVerifiedAt, &user.CreatedAt)
 	if err != nil {
 		utils.Log.ErrorContext(ctx, "error on fetching user", "function", "Read", "error", err)
 		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
@@ -129,78 +230,134 @@ func (r *AuthRepo) GetUserByID(ctx context.Context, userID int) (*models.User, i
 	return user, http.StatusOK, nil
 }
 
-// DeleteUser deletes a user from the database based on the provided userID.
+// DeleteUser deletes a user from the database based on the provided userID
+// and revokes the access token the request was made with as well as the access tokens of every session of the user.
 // It returns an HTTP status code and an error if any occurs during the deletion process.
 //
 // Parameters:
 //   - ctx: The context for the request, used for cancellation and deadlines.
 //   - userID: The ID of the user to be deleted.
+//   - accessTokenID: The jti of the access token to revoke.
+//   - accessTokenExpire: The expiration time of the access token in Unix time format.
 //
 // Returns:
 //   - int: An HTTP status code indicating the result of the operation.
 //   - error: An error message if the deletion fails, otherwise nil.
-func (r *AuthRepo) DeleteUser(ctx context.Context, userID int) (int, error) {
+func (r *AuthRepo) DeleteUser(ctx context.Context, userID int, accessTokenID string, accessTokenExpire int64) (int, error) {
+	if err := r.revokeUserSessions(ctx, userID, ""); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
 	_, err := r.db.ExecContext(ctx, DELETE_USER, userID)
 	if err != nil {
 		utils.Log.ErrorContext(ctx, "error on deleting user", "function", "Delete", "error", err)
 		return http.StatusInternalServerError, fmt.Errorf("please try again later")
 	}
+	if status, err := r.RevokeAccessToken(ctx, accessTokenID, accessTokenExpire); err != nil {
+		return status, err
+	}
 	return http.StatusAccepted, nil
 }
 
 // LoginUser authenticates a user by verifying their email and password.
 // It fetches the user details from the database using the provided email,
 // checks if the password is correct, and returns authentication tokens if successful.
+// A password hash made with an older algorithm or older parameters is replaced by a hash with the current ones.
+// Failed logins are counted per account and per IP address: after LOGIN_BACKOFF_AFTER failures every further
+// attempt has to wait exponentially longer, and LOGIN_LOCKOUT_THRESHOLD failures lock the account for
+// LOGIN_LOCKOUT_DURATION minutes and email the owner a link to unlock it.
+// Every successful login starts a new session, so a user can stay logged in on several devices at once.
+// For users with two-factor authentication enabled no session is started yet, instead a short-lived
+// mfa_pending token is returned, which LoginMFA exchanges for the tokens together with a code.
 //
 // Parameters:
 //   - ctx: The context for the request, used for timeout and cancellation.
 //   - user: A pointer to the User model containing the email and password for authentication.
 //
 // Returns:
-//   - A pointer to the TokenResponse model containing the authentication tokens if login is successful.
+//   - A pointer to the TokenResponse model containing the authentication tokens or the mfa_pending token if login is successful.
 //   - An integer representing the HTTP status code.
 //   - An error if any issue occurs during the login process.
 //
 // Possible HTTP status codes:
 //   - http.StatusBadRequest: If the user does not exist.
 //   - http.StatusUnauthorized: If the password is incorrect.
+//   - http.StatusForbidden: If REQUIRE_EMAIL_VERIFICATION is set and the email isn't verified yet.
+//   - http.StatusTooManyRequests: If the account has to wait or the IP address is locked after failed logins.
+//   - http.StatusLocked: If the account is locked after too many failed logins.
 //   - http.StatusInternalServerError: If there is an error during the database query or token generation.
 func (r *AuthRepo) LoginUser(ctx context.Context, user *models.User) (*models.TokenResponse, int, error) {
+	if status, err := r.checkLoginIP(ctx); err != nil {
+		return nil, status, err
+	}
+
 	existUser := &models.User{}
-	err := r.db.QueryRowContext(ctx, FETCH_USER_BY_EMAIL, user.Email).Scan(&existUser.ID, &existUser.Email, &existUser.Password)
+	err := r.db.QueryRowContext(ctx, FETCH_USER_BY_EMAIL, user.Email).Scan(&existUser.ID, &existUser.Email, &existUser.Password, &existUser.EmailVerifiedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
+			r.recordLoginFailure(ctx, 0, "")
 			return nil, http.StatusBadRequest, fmt.Errorf("please check credentials")
 		}
 		utils.Log.ErrorContext(ctx, "error on fetching user", "function", "Login", "error", err)
 		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
 	}
 
+	// The block is checked before the password, otherwise guessing could go on during the block.
+	if status, err := r.checkLoginAccount(ctx, existUser.ID); err != nil {
+		return nil, status, err
+	}
+
 	isValid := checkPassword(existUser.Password, user.Password)
 	if !isValid {
+		r.recordLoginFailure(ctx, existUser.ID, existUser.Email)
 		return nil, http.StatusUnauthorized, fmt.Errorf("incorrect password, please try again")
 	}
+	r.attempts.Reset(ctx, userAttemptKey(existUser.ID))
+	r.rehashPassword(ctx, existUser.ID, existUser.Password, user.Password)
+
+	if config.Envs.REQUIRE_EMAIL_VERIFICATION && existUser.EmailVerifiedAt == nil {
+		return nil, http.StatusForbidden, fmt.Errorf("please verify your email before logging in")
+	}
+
+	mfaResponse, err := r.mfaPendingLogin(ctx, existUser.ID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	if mfaResponse != nil {
+		return mfaResponse, http.StatusOK, nil
+	}
 
-	return r.getAuthTokens(ctx, existUser.ID)
+	sessionID, err := newSessionID()
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on generating session id", "function", "Login", "error", err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+
+	return r.getAuthTokens(ctx, existUser.ID, sessionID)
 }
 
-// GenerateTokens generates new authentication tokens for a user.
-// It validates the provided old refresh token against the stored token in the database.
-// If the tokens match, it generates and returns new authentication tokens.
-// If the tokens do not match or an error occurs during the process, it returns an appropriate error and status code.
+// GenerateTokens rotates the refresh token of a user session and issues a new pair of authentication tokens.
+// The user and the session are taken from the claims of the refresh token itself, so no (possibly expired)
+// access token is needed.
+// Every session is a rotation family: only the hash of the latest refresh token of the family is stored,
+// and each refresh replaces it. Presenting a refresh token of the family that was already rotated means the token
+// was replayed (most likely stolen), so the whole family is revoked and a security event is recorded.
 //
 // Parameters:
 //   - ctx: The context for the request.
-//   - userID: The ID of the user for whom the tokens are being generated.
 //   - oldRefreshToken: The old refresh token provided by the user.
 //
 // Returns:
 //   - *models.TokenResponse: The new authentication tokens if successful.
 //   - int: The HTTP status code indicating the result of the operation.
 //   - error: An error message if the operation fails.
-func (r *AuthRepo) GenerateTokens(ctx context.Context, userID int, oldRefreshToken string) (*models.TokenResponse, int, error) {
+func (r *AuthRepo) GenerateTokens(ctx context.Context, oldRefreshToken string) (*models.TokenResponse, int, error) {
+	_, userID, sessionID, err := r.verifyToken(oldRefreshToken, utils.RefreshTokenType)
+	if err != nil {
+		return nil, http.StatusUnauthorized, fmt.Errorf("invalid token, please login again")
+	}
+
 	var dbRefreshToken string
-	err := r.db.QueryRowContext(ctx, FETCH_REFRESH_TOKEN, userID).Scan(&dbRefreshToken)
+	err = r.db.QueryRowContext(ctx, FETCH_REFRESH_TOKEN, sessionID, userID).Scan(&dbRefreshToken)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, http.StatusUnauthorized, fmt.Errorf("please login again")
@@ -208,61 +365,150 @@ func (r *AuthRepo) GenerateTokens(ctx context.Context, userID int, oldRefreshTok
 		utils.Log.ErrorContext(ctx, "error on fetching from refresh_tokens_table", "function", "GenerateAuthTokens", "error", err)
 		return nil, http.StatusInternalServerError, fmt.Errorf("please login again")
 	}
-	if dbRefreshToken != oldRefreshToken {
+	oldRefreshTokenHash := hashToken(oldRefreshToken)
+	if !tokenHashEqual(dbRefreshToken, oldRefreshTokenHash) {
+		r.revokeTokenFamily(ctx, userID, sessionID)
+		return nil, http.StatusUnauthorized, fmt.Errorf("invalid token, please login again")
+	}
+
+	tokens, refreshTokenExpire, err := getTokenPair(userID, sessionID, r.auth)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+
+	// The old token is part of the WHERE clause, so when two requests race with the same
+	// refresh token only one of them rotates it and the other one is treated as a replay.
+	res, err := r.db.ExecContext(ctx, ROTATE_REFRESH_TOKEN, hashToken(tokens.RefreshToken), refreshTokenExpire, sessionID, userID, oldRefreshTokenHash)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on rotating refresh token in db", "function", "GenerateAuthTokens", "error", err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	if rows, err := res.RowsAffected(); err != nil || rows == 0 {
+		r.revokeTokenFamily(ctx, userID, sessionID)
 		return nil, http.StatusUnauthorized, fmt.Errorf("invalid token, please login again")
 	}
 
-	return r.getAuthTokens(ctx, userID)
+	return tokens, http.StatusOK, nil
+}
+
+// verifyToken verifies the signature and the registered claims of a token and checks that it is of the
+// given type. It returns the parsed token along with the user ID and session ID from its claims.
+func (r *AuthRepo) verifyToken(tokenString string, tokenType string) (jwt.Token, int, string, error) {
+	token, err := r.auth.Verify(tokenString)
+	if err == nil {
+		err = config.ValidateIssuerAndAudience(token)
+	}
+	if err == nil {
+		err = config.ValidateTokenType(token, tokenType)
+	}
+	if err != nil {
+		return nil, 0, "", err
+	}
+	userID, err := strconv.Atoi(token.Subject())
+	if err != nil {
+		return nil, 0, "", err
+	}
+	sessionID, ok := token.PrivateClaims()["sid"].(string)
+	if !ok || sessionID == "" {
+		return nil, 0, "", fmt.Errorf("missing session id")
+	}
+	return token, userID, sessionID, nil
+}
+
+// revokeTokenFamily deletes the session a replayed refresh token belongs to, which invalidates every
+// refresh token of that rotation family, revokes the access tokens of the session and records the reuse
+// as a security event.
+func (r *AuthRepo) revokeTokenFamily(ctx context.Context, userID int, sessionID string) {
+	utils.Log.WarnContext(ctx, "refresh token reuse detected, revoking token family", "function", "GenerateAuthTokens", "userID", userID, "sessionID", sessionID)
+	_, err := r.db.ExecContext(ctx, DELETE_TOKEN_REFRESH_TABLE, sessionID, userID)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on revoking token family", "function", "GenerateAuthTokens", "error", err)
+	}
+	if err := r.revokeSession(ctx, sessionID); err != nil {
+		utils.Log.ErrorContext(ctx, "error on revoking the access tokens of the token family", "function", "GenerateAuthTokens", "error", err)
+	}
+	r.recordSecurityEvent(ctx, userID, sessionID, SECURITY_EVENT_REFRESH_TOKEN_REUSE, "already rotated refresh token presented, token family revoked")
 }
 
-// getAuthTokens generates and returns new access and refresh tokens for a given user ID.
-// It stores the refresh token in the database and returns a TokenResponse containing both tokens.
+// getAuthTokens generates and returns new access and refresh tokens for a given user ID and a new session.
+// It stores the hash of the refresh token in the database as the first token of the session's rotation family
+// and returns a TokenResponse containing both tokens.
 //
 // Parameters:
 //   - ctx: The context for the request, used for timeout and cancellation.
 //   - userID: The ID of the user for whom the tokens are being generated.
+//   - sessionID: The ID of the session the tokens belong to.
 //
 // Returns:
 //   - *models.TokenResponse: A struct containing the generated access and refresh tokens.
 //   - int: The HTTP status code indicating the result of the operation.
 //   - error: An error object if an error occurred, otherwise nil.
-func (r *AuthRepo) getAuthTokens(ctx context.Context, userID int) (*models.TokenResponse, int, error) {
-	accessToken, err := getToken(userID, r.auth, time.Now().Add(time.Duration(config.Envs.HTTP_ACCESS_TOKEN_EXPIRE)*time.Minute).Unix())
+func (r *AuthRepo) getAuthTokens(ctx context.Context, userID int, sessionID string) (*models.TokenResponse, int, error) {
+	tokens, refreshTokenExpire, err := getTokenPair(userID, sessionID, r.auth)
 	if err != nil {
 		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
 	}
-	refreshTokenExpire := time.Now().Add(time.Duration(config.Envs.HTTP_REFRESH_TOKEN_EXPIRE) * time.Minute).Unix()
-	refreshToken, err := getToken(userID, r.auth, refreshTokenExpire)
+
+	_, err = r.db.ExecContext(ctx, INSERT_REFRESH_TOKEN, sessionID, userID, hashToken(tokens.RefreshToken), refreshTokenExpire)
 	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on saving refresh token in db", "function", "LoginUser", "error", err)
 		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
 	}
+	return tokens, http.StatusOK, nil
+}
 
-	_, err = r.db.ExecContext(ctx, INSERT_REFRESH_TOKEN, userID, refreshToken, refreshTokenExpire)
+// getTokenPair signs a new access and refresh token for a user session.
+// It returns both tokens along with the expiration time of the refresh token in Unix time format.
+func getTokenPair(userID int, sessionID string, auth *config.KeyRing) (*models.TokenResponse, int64, error) {
+	accessToken, err := getToken(userID, sessionID, utils.AccessTokenType, auth, time.Now().Add(time.Duration(config.Envs.HTTP_ACCESS_TOKEN_EXPIRE)*time.Minute).Unix())
 	if err != nil {
-		utils.Log.ErrorContext(ctx, "error on saving refresh token in db", "function", "LoginUser", "error", err)
-		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+		return nil, 0, err
 	}
-	return &models.TokenResponse{AccessToken: accessToken, RefreshToken: refreshToken}, http.StatusOK, err
+	refreshTokenExpire := time.Now().Add(time.Duration(config.Envs.HTTP_REFRESH_TOKEN_EXPIRE) * time.Minute).Unix()
+	refreshToken, err := getToken(userID, sessionID, utils.RefreshTokenType, auth, refreshTokenExpire)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &models.TokenResponse{AccessToken: accessToken, RefreshToken: refreshToken}, refreshTokenExpire, nil
 }
 
-// getToken generates a JWT token for a given user ID with an expiration time.
-// It takes the user ID, a JWTAuth instance, and the expiration time as parameters.
+// getToken generates a JWT token of the given type for a given user ID and session with an expiration time.
+// Besides the session and the token type (typ) it carries the registered claims iss, aud, sub (the user ID),
+// iat, nbf and a unique jti.
+// It takes the user ID, the session ID, the token type, the KeyRing signing the token, and the expiration time as parameters.
 // It returns the generated token as a string and an error if the token generation fails.
 //
 // Parameters:
 //   - userID: The ID of the user for whom the token is being generated.
-//   - auth: A pointer to a jwtauth.JWTAuth instance used for encoding the token.
+//   - sessionID: The ID of the session the token belongs to.
+//   - tokenType: utils.AccessTokenType or utils.RefreshTokenType.
+//   - auth: A pointer to the config.KeyRing whose active key signs the token.
 //   - expireTime: The expiration time of the token in Unix time format.
 //
 // Returns:
 //   - string: The generated JWT token.
 //   - error: An error if the token generation fails.
-func getToken(userID int, auth *jwtauth.JWTAuth, expireTime int64) (string, error) {
+func getToken(userID int, sessionID string, tokenType string, auth *config.KeyRing, expireTime int64) (string, error) {
+	// jti makes every token unique, otherwise two tokens of a family signed within
+	// the same second would be identical and a replay couldn't be told apart.
+	jti, err := newSessionID()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().Unix()
 	claims := map[string]any{
-		"userID": userID,
+		"iss":    config.Envs.JWT_ISSUER,
+		"aud":    config.Envs.JWT_AUDIENCE,
+		"sub":    strconv.Itoa(userID),
+		"iat":    now,
+		"nbf":    now,
 		"exp":    expireTime,
+		"jti":    jti,
+		"userID": userID,
+		"sid":    sessionID,
+		"typ":    tokenType,
 	}
-	_, token, err := auth.Encode(claims)
+	token, err := auth.Encode(claims)
 	if err != nil {
 		utils.Log.Error("error on generating auth token", "function", "generateAuthToken", "error", err)
 		return "", err
@@ -270,16 +516,23 @@ func getToken(userID int, auth *jwtauth.JWTAuth, expireTime int64) (string, erro
 	return token, nil
 }
 
-func getHashPassword(password string) (string, error) {
-	bytePassword := []byte(password)
-	hash, err := bcrypt.GenerateFromPassword(bytePassword, bcrypt.DefaultCost)
-	if err != nil {
+// newSessionID returns a random, hex encoded identifier for a new login session.
+// It is also used for any other random identifier, e.g. token IDs.
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
-	return string(hash), nil
+	return hex.EncodeToString(b), nil
+}
+
+// getHashPassword hashes a password with the configured PASSWORD_HASHER.
+func getHashPassword(password string) (string, error) {
+	return hasher.NewPasswordHasher().Hash(password)
 }
 
+// checkPassword verifies a password against a stored hash of any supported algorithm, e.g. older bcrypt hashes.
 func checkPassword(hashPassword, password string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashPassword), []byte(password))
-	return err == nil
+	ok, err := hasher.NewPasswordHasher().Verify(hashPassword, password)
+	return err == nil && ok
 }
@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/config"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/mailer"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/utils"
+)
+
+const (
+	FETCH_USER_EMAIL_AND_PASSWORD = `SELECT email, password FROM users WHERE id = ?`
+	FETCH_USER_EMAIL              = `SELECT email FROM users WHERE id = ?`
+	UPDATE_USER_EMAIL             = `UPDATE users SET email = ?, email_verified_at = CURRENT_TIMESTAMP WHERE id = ?`
+)
+
+// emailChangeCancelTTL is how long the cancel link sent to the old address works. It outlives the confirmation
+// link, so the owner of the old address can still undo a change which was confirmed by someone else.
+const emailChangeCancelTTL = 7 * 24 * time.Hour
+
+// RequestEmailChange starts changing the email address of a logged in user after checking their password.
+// A wrong password counts as a failed login, like on ChangePassword.
+// The address isn't changed yet: a confirmation link is sent to the new address, and a notice with a link
+// to cancel the change is sent to the old one.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - userID: The ID of the user.
+//   - password: The current password of the user.
+//   - newEmail: The new email address.
+//
+// Returns:
+//   - int: The HTTP status code indicating the result of the operation.
+//   - error: An error message if the operation fails.
+func (r *AuthRepo) RequestEmailChange(ctx context.Context, userID int, password string, newEmail string) (int, error) {
+	var email, hashPassword string
+	err := r.db.QueryRowContext(ctx, FETCH_USER_EMAIL_AND_PASSWORD, userID).Scan(&email, &hashPassword)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on fetching user", "function", "RequestEmailChange", "error", err)
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	if status, err := r.checkCurrentPassword(ctx, userID, email, hashPassword, password); err != nil {
+		return status, err
+	}
+	if email == newEmail {
+		return http.StatusBadRequest, fmt.Errorf("this is already your email address")
+	}
+
+	taken, err := r.isEmailTaken(ctx, newEmail)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	if taken {
+		return http.StatusBadRequest, fmt.Errorf("email already taken, please use different email")
+	}
+
+	// Only the latest request can be confirmed.
+	r.invalidateUserTokens(ctx, userID, utils.EmailChangeTokenType)
+	confirmToken, err := r.issueUserToken(ctx, userID, utils.EmailChangeTokenType, time.Duration(config.Envs.EMAIL_CHANGE_EXPIRE)*time.Minute, newEmail)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	cancelToken, err := r.issueUserToken(ctx, userID, utils.EmailChangeCancelTokenType, emailChangeCancelTTL, email)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+
+	if err := r.mailer.Send(ctx, mailer.NewEmailChangeEmail(newEmail, confirmToken)); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	if err := r.mailer.Send(ctx, mailer.NewEmailChangeNoticeEmail(email, newEmail, cancelToken)); err != nil {
+		utils.Log.ErrorContext(ctx, "error on sending email change notice", "function", "RequestEmailChange", "error", err)
+	}
+	return http.StatusOK, nil
+}
+
+// ConfirmEmailChange changes the email address of a user to the address the confirmation link was sent to.
+// As the link was opened from that inbox, the new address counts as verified. If the address was taken
+// by another account in the meantime, the change fails and the link stays usable.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - token: The confirmation token from the email.
+//
+// Returns:
+//   - int: The HTTP status code indicating the result of the operation.
+//   - error: An error message if the operation fails.
+func (r *AuthRepo) ConfirmEmailChange(ctx context.Context, token string) (int, error) {
+	userID, newEmail, err := r.peekUserToken(ctx, token, utils.EmailChangeTokenType)
+	if err == nil {
+		// The address may have been taken since the change was requested, which leaves the link usable.
+		var taken bool
+		taken, err = r.isEmailTaken(ctx, newEmail)
+		if err == nil && taken {
+			return http.StatusBadRequest, fmt.Errorf("email already taken, please use different email")
+		}
+		if err == nil {
+			_, _, err = r.consumeUserToken(ctx, token, utils.EmailChangeTokenType)
+		}
+	}
+	if err != nil {
+		if err == errInvalidUserToken {
+			return http.StatusBadRequest, fmt.Errorf("invalid or expired link, please request a new one")
+		}
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+
+	if status, err := r.updateEmail(ctx, userID, newEmail); err != nil {
+		// The address can still be taken between the check and the update, which mustn't cost the link either.
+		r.restoreUserToken(ctx, token, utils.EmailChangeTokenType)
+		return status, err
+	}
+	r.recordSecurityEvent(ctx, userID, "", SECURITY_EVENT_EMAIL_CHANGE, "email address changed to "+newEmail)
+	return http.StatusOK, nil
+}
+
+// CancelEmailChange cancels an email change using the link sent to the old address.
+// Pending confirmation links stop working. If the change was already confirmed, the old address is restored
+// and every session of the user is logged out and its access tokens revoked, as the change most likely came from someone else.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - token: The cancel token from the email.
+//
+// Returns:
+//   - int: The HTTP status code indicating the result of the operation.
+//   - error: An error message if the operation fails.
+func (r *AuthRepo) CancelEmailChange(ctx context.Context, token string) (int, error) {
+	userID, oldEmail, err := r.consumeUserToken(ctx, token, utils.EmailChangeCancelTokenType)
+	if err != nil {
+		if err == errInvalidUserToken {
+			return http.StatusBadRequest, fmt.Errorf("invalid or expired link")
+		}
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+
+	if err := r.invalidateUserTokens(ctx, userID, utils.EmailChangeTokenType); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+
+	var email string
+	err = r.db.QueryRowContext(ctx, FETCH_USER_EMAIL, userID).Scan(&email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return http.StatusBadRequest, fmt.Errorf("invalid or expired link")
+		}
+		utils.Log.ErrorContext(ctx, "error on fetching user", "function", "CancelEmailChange", "error", err)
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	if email == oldEmail {
+		r.recordSecurityEvent(ctx, userID, "", SECURITY_EVENT_EMAIL_CHANGE_CANCEL, "pending email change cancelled")
+		return http.StatusOK, nil
+	}
+
+	if status, err := r.updateEmail(ctx, userID, oldEmail); err != nil {
+		return status, err
+	}
+	if err := r.revokeUserSessions(ctx, userID, ""); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	if _, err := r.db.ExecContext(ctx, DELETE_USER_SESSIONS, userID); err != nil {
+		utils.Log.ErrorContext(ctx, "error on deleting user sessions", "function", "CancelEmailChange", "error", err)
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	r.recordSecurityEvent(ctx, userID, "", SECURITY_EVENT_EMAIL_CHANGE_CANCEL, "email address restored to "+oldEmail+", all sessions logged out")
+	return http.StatusOK, nil
+}
+
+// updateEmail sets the email address of a user and marks it as verified.
+func (r *AuthRepo) updateEmail(ctx context.Context, userID int, email string) (int, error) {
+	_, err := r.db.ExecContext(ctx, UPDATE_USER_EMAIL, email, userID)
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+			return http.StatusBadRequest, fmt.Errorf("email already taken, please use different email")
+		}
+		utils.Log.ErrorContext(ctx, "error on updating email", "function", "updateEmail", "error", err)
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	return http.StatusOK, nil
+}
@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/models"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/utils"
+)
+
+// IntrospectToken reports whether a token is active, following RFC 7662.
+// The token has to pass the same signature and claim checks as on the protected routes. On top of that,
+// an access token and its session must not be on the revocation denylist, and a refresh token must still be the current
+// token of its session in refresh_tokens_table, so logged out or rotated refresh tokens are inactive.
+// tokenTypeHint ("access_token" or "refresh_token") decides which type is tried first.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - tokenString: The token to introspect.
+//   - tokenTypeHint: The optional token_type_hint sent by the client.
+//
+// Returns:
+//   - *models.IntrospectionResponse: The introspection result, with only active set to false for inactive tokens.
+//   - int: The HTTP status code indicating the result of the operation.
+//   - error: An error message if the token state couldn't be checked.
+func (r *AuthRepo) IntrospectToken(ctx context.Context, tokenString string, tokenTypeHint string) (*models.IntrospectionResponse, int, error) {
+	tokenTypes := []string{utils.AccessTokenType, utils.RefreshTokenType}
+	if tokenTypeHint == models.REFRESH_TOKEN_TYPE_HINT {
+		tokenTypes = []string{utils.RefreshTokenType, utils.AccessTokenType}
+	}
+
+	for _, tokenType := range tokenTypes {
+		token, userID, sessionID, err := r.verifyToken(tokenString, tokenType)
+		if err != nil {
+			continue
+		}
+
+		var active bool
+		if tokenType == utils.AccessTokenType {
+			active, err = r.isAccessTokenActive(ctx, token, sessionID)
+		} else {
+			active, err = r.isRefreshTokenActive(ctx, userID, sessionID, tokenString)
+		}
+		if err != nil {
+			return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+		}
+		if !active {
+			break
+		}
+		return newIntrospectionResponse(token, tokenType), http.StatusOK, nil
+	}
+	return &models.IntrospectionResponse{Active: false}, http.StatusOK, nil
+}
+
+// isAccessTokenActive reports whether neither an access token nor its session is on the revocation denylist.
+func (r *AuthRepo) isAccessTokenActive(ctx context.Context, token jwt.Token, sessionID string) (bool, error) {
+	revoked, err := IsAccessTokenRevoked(ctx, r.revoked, token.JwtID(), sessionID)
+	return !revoked, err
+}
+
+// isRefreshTokenActive reports whether a refresh token is the current token of its session.
+func (r *AuthRepo) isRefreshTokenActive(ctx context.Context, userID int, sessionID string, refreshToken string) (bool, error) {
+	var dbRefreshToken string
+	err := r.db.QueryRowContext(ctx, FETCH_REFRESH_TOKEN, sessionID, userID).Scan(&dbRefreshToken)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		utils.Log.ErrorContext(ctx, "error on fetching from refresh_tokens_table", "function", "IntrospectToken", "error", err)
+		return false, err
+	}
+	return tokenHashEqual(dbRefreshToken, hashToken(refreshToken)), nil
+}
+
+func newIntrospectionResponse(token jwt.Token, tokenType string) *models.IntrospectionResponse {
+	res := &models.IntrospectionResponse{
+		Active:    true,
+		TokenType: models.ACCESS_TOKEN_TYPE_HINT,
+		Subject:   token.Subject(),
+		Audience:  token.Audience(),
+		Issuer:    token.Issuer(),
+		TokenID:   token.JwtID(),
+		ExpireAt:  token.Expiration().Unix(),
+		IssuedAt:  token.IssuedAt().Unix(),
+		NotBefore: token.NotBefore().Unix(),
+	}
+	if tokenType == utils.RefreshTokenType {
+		res.TokenType = models.REFRESH_TOKEN_TYPE_HINT
+	}
+	return res
+}
+
+// RevokeToken revokes a single access or refresh token, following RFC 7009.
+// A refresh token ends the session it belongs to, the same way LogoutUser does, and as RFC 7009 asks for,
+// also revokes the access tokens of the session: the session is put on the revocation denylist for as long
+// as an access token issued for it can be valid. An access token alone is put on the denylist until it expires. Tokens which are invalid, expired or already revoked are
+// ignored, as the RFC asks to answer them like successfully revoked tokens.
+// tokenTypeHint ("access_token" or "refresh_token") decides which type is tried first.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - tokenString: The token to revoke.
+//   - tokenTypeHint: The optional token_type_hint sent by the client.
+//
+// Returns:
+//   - int: The HTTP status code indicating the result of the operation.
+//   - error: An error message if the token couldn't be revoked.
+func (r *AuthRepo) RevokeToken(ctx context.Context, tokenString string, tokenTypeHint string) (int, error) {
+	tokenTypes := []string{utils.AccessTokenType, utils.RefreshTokenType}
+	if tokenTypeHint == models.REFRESH_TOKEN_TYPE_HINT {
+		tokenTypes = []string{utils.RefreshTokenType, utils.AccessTokenType}
+	}
+
+	for _, tokenType := range tokenTypes {
+		token, userID, sessionID, err := r.verifyToken(tokenString, tokenType)
+		if err != nil {
+			continue
+		}
+
+		if tokenType == utils.AccessTokenType {
+			if err := r.revoked.Revoke(ctx, token.JwtID(), token.Expiration().Unix()); err != nil {
+				return http.StatusServiceUnavailable, fmt.Errorf("please try again later")
+			}
+			return http.StatusOK, nil
+		}
+
+		_, err = r.db.ExecContext(ctx, DELETE_TOKEN_REFRESH_TABLE, sessionID, userID)
+		if err != nil {
+			utils.Log.ErrorContext(ctx, "error on deleting from refresh_tokens_table", "function", "RevokeToken", "error", err)
+			return http.StatusServiceUnavailable, fmt.Errorf("please try again later")
+		}
+		if err := r.revokeSession(ctx, sessionID); err != nil {
+			return http.StatusServiceUnavailable, fmt.Errorf("please try again later")
+		}
+		return http.StatusOK, nil
+	}
+	return http.StatusOK, nil
+}
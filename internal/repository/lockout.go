@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/config"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/mailer"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/utils"
+)
+
+// accountUnlockTTL is how long the unlock link of a locked account works.
+const accountUnlockTTL = 24 * time.Hour
+
+// loginPolicy returns the policy of failed logins of a single account.
+func loginPolicy() *AttemptPolicy {
+	return &AttemptPolicy{
+		Window:           time.Duration(config.Envs.LOGIN_FAILURE_WINDOW) * time.Minute,
+		BackoffAfter:     config.Envs.LOGIN_BACKOFF_AFTER,
+		BackoffBase:      time.Duration(config.Envs.LOGIN_BACKOFF_BASE_SEC) * time.Second,
+		BackoffMax:       time.Duration(config.Envs.LOGIN_BACKOFF_MAX_SEC) * time.Second,
+		LockoutThreshold: config.Envs.LOGIN_LOCKOUT_THRESHOLD,
+		LockoutDuration:  time.Duration(config.Envs.LOGIN_LOCKOUT_DURATION) * time.Minute,
+	}
+}
+
+// loginIPPolicy returns the policy of failed logins from a single IP address. An IP address may be shared
+// by many users, so only the lockout applies, with its own threshold.
+func loginIPPolicy() *AttemptPolicy {
+	return &AttemptPolicy{
+		Window:           time.Duration(config.Envs.LOGIN_FAILURE_WINDOW) * time.Minute,
+		BackoffAfter:     config.Envs.LOGIN_IP_LOCKOUT_THRESHOLD,
+		LockoutThreshold: config.Envs.LOGIN_IP_LOCKOUT_THRESHOLD,
+		LockoutDuration:  time.Duration(config.Envs.LOGIN_LOCKOUT_DURATION) * time.Minute,
+	}
+}
+
+func userAttemptKey(userID int) string {
+	return "login:user:" + strconv.Itoa(userID)
+}
+
+func ipAttemptKey(ip string) string {
+	return "login:ip:" + ip
+}
+
+// clientIP returns the IP address of the client the request came from, set by the clientIP middleware.
+func clientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(utils.ClientIPCtxKey).(string)
+	return ip
+}
+
+// checkLoginIP refuses a login attempt while the IP address of the client is locked after failed logins.
+func (r *AuthRepo) checkLoginIP(ctx context.Context) (int, error) {
+	ip := clientIP(ctx)
+	if ip == "" {
+		return http.StatusOK, nil
+	}
+	attempts, err := r.attempts.Get(ctx, ipAttemptKey(ip))
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	now := time.Now()
+	if attempts.IsBlocked(now) {
+		return http.StatusTooManyRequests, fmt.Errorf("too many failed logins from your network, please try again in %d seconds", attempts.BlockedUntil-now.Unix())
+	}
+	return http.StatusOK, nil
+}
+
+// checkLoginAccount refuses a login attempt while the account has to wait or is locked after failed logins.
+func (r *AuthRepo) checkLoginAccount(ctx context.Context, userID int) (int, error) {
+	attempts, err := r.attempts.Get(ctx, userAttemptKey(userID))
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	now := time.Now()
+	if !attempts.IsBlocked(now) {
+		return http.StatusOK, nil
+	}
+	wait := attempts.BlockedUntil - now.Unix()
+	if loginPolicy().IsLockedOut(attempts) {
+		return http.StatusLocked, fmt.Errorf("too many failed logins, locked for %d seconds, check your email for a link to unlock your account", wait)
+	}
+	return http.StatusTooManyRequests, fmt.Errorf("too many failed logins, please try again in %d seconds", wait)
+}
+
+// recordLoginFailure counts a failed login for the IP address of the client and, if known, the account.
+// When the account gets locked, its owner is emailed a link to unlock it. Errors are only logged, the login failed anyway.
+func (r *AuthRepo) recordLoginFailure(ctx context.Context, userID int, email string) {
+	if ip := clientIP(ctx); ip != "" {
+		r.attempts.Fail(ctx, ipAttemptKey(ip), loginIPPolicy())
+	}
+	if userID == 0 {
+		return
+	}
+
+	policy := loginPolicy()
+	attempts, err := r.attempts.Fail(ctx, userAttemptKey(userID), policy)
+	if err != nil || attempts.Failures != policy.LockoutThreshold {
+		return
+	}
+	utils.Log.WarnContext(ctx, "account locked after failed logins", "function", "recordLoginFailure", "userID", userID)
+	r.recordSecurityEvent(ctx, userID, "", SECURITY_EVENT_ACCOUNT_LOCKED, fmt.Sprintf("locked after %d failed logins, last from %s", attempts.Failures, clientIP(ctx)))
+	token, err := r.issueUserToken(ctx, userID, utils.AccountUnlockTokenType, accountUnlockTTL, "")
+	if err == nil {
+		err = r.mailer.Send(ctx, mailer.NewAccountLockedEmail(email, token, policy.LockoutDuration))
+	}
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on sending unlock email", "function", "recordLoginFailure", "error", err)
+	}
+}
+
+// checkCurrentPassword checks the password a logged in user confirms an action with. Like a login, a wrong
+// password counts as a failed login of the account, and the check is refused while the account has to wait
+// or is locked, so a stolen access token can't be used to guess the password.
+func (r *AuthRepo) checkCurrentPassword(ctx context.Context, userID int, email string, hashPassword string, password string) (int, error) {
+	if status, err := r.checkLoginAccount(ctx, userID); err != nil {
+		return status, err
+	}
+	if !checkPassword(hashPassword, password) {
+		r.recordLoginFailure(ctx, userID, email)
+		return http.StatusUnauthorized, fmt.Errorf("incorrect password, please try again")
+	}
+	r.attempts.Reset(ctx, userAttemptKey(userID))
+	return http.StatusOK, nil
+}
+
+// UnlockAccount lifts the lockout of an account using the single-use token from the unlock email.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - token: The unlock token from the email.
+//
+// Returns:
+//   - int: The HTTP status code indicating the result of the operation.
+//   - error: An error message if the operation fails.
+func (r *AuthRepo) UnlockAccount(ctx context.Context, token string) (int, error) {
+	userID, _, err := r.consumeUserToken(ctx, token, utils.AccountUnlockTokenType)
+	if err != nil {
+		if err == errInvalidUserToken {
+			return http.StatusBadRequest, fmt.Errorf("invalid or expired link")
+		}
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	return r.UnlockUser(ctx, userID)
+}
+
+// UnlockUser lifts the lockout and the backoff delays of an account, e.g. on request of an admin.
+// This covers wrong passwords as well as wrong two-factor codes and wrong email login codes.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - userID: The ID of the user to unlock.
+//
+// Returns:
+//   - int: The HTTP status code indicating the result of the operation.
+//   - error: An error message if the operation fails.
+func (r *AuthRepo) UnlockUser(ctx context.Context, userID int) (int, error) {
+	for _, key := range []string{userAttemptKey(userID), mfaAttemptKey(userID), emailOTPAttemptKey(userID)} {
+		if err := r.attempts.Reset(ctx, key); err != nil {
+			return http.StatusInternalServerError, fmt.Errorf("please try again later")
+		}
+	}
+	r.invalidateUserTokens(ctx, userID, utils.AccountUnlockTokenType)
+	r.recordSecurityEvent(ctx, userID, "", SECURITY_EVENT_ACCOUNT_UNLOCKED, "failed logins reset")
+	return http.StatusOK, nil
+}
@@ -0,0 +1,438 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/config"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/models"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/otp"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/secrets"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/utils"
+)
+
+const (
+	FETCH_USER_MFA  = `SELECT totp_secret, last_used_step, enabled_at FROM user_mfa WHERE user_id = ?`
+	UPSERT_USER_MFA = `
+		INSERT INTO user_mfa (user_id, totp_secret) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE
+		totp_secret = VALUES(totp_secret),
+		last_used_step = 0,
+		created_at = CURRENT_TIMESTAMP
+	`
+	ENABLE_USER_MFA       = `UPDATE user_mfa SET enabled_at = CURRENT_TIMESTAMP, last_used_step = ? WHERE user_id = ? AND enabled_at IS NULL`
+	USE_TOTP_STEP         = `UPDATE user_mfa SET last_used_step = ? WHERE user_id = ? AND enabled_at IS NOT NULL AND last_used_step < ?`
+	DELETE_USER_MFA       = `DELETE FROM user_mfa WHERE user_id = ?`
+	INSERT_RECOVERY_CODE  = `INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES (?, ?)`
+	USE_RECOVERY_CODE     = `UPDATE mfa_recovery_codes SET used_at = CURRENT_TIMESTAMP WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`
+	DELETE_RECOVERY_CODES = `DELETE FROM mfa_recovery_codes WHERE user_id = ?`
+	COUNT_RECOVERY_CODES  = `SELECT count(id) FROM mfa_recovery_codes WHERE user_id = ? AND used_at IS NULL`
+	recoveryCodeCount     = 10
+	recoveryCodeLength    = 10
+	totpSkew              = 1
+)
+
+var recoveryCodeEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// userMFA is the second factor of a user. The TOTP secret stays encrypted until it is needed.
+type userMFA struct {
+	encryptedSecret string
+	lastUsedStep    int64
+	enabledAt       *time.Time
+}
+
+func mfaAttemptKey(userID int) string {
+	return "mfa:user:" + strconv.Itoa(userID)
+}
+
+// EnrollTOTP starts the enrollment of an authenticator app by creating a new TOTP secret for a user.
+// The secret only protects logins after it was confirmed with ConfirmTOTP, until then a new enrollment replaces it.
+// It is stored encrypted with MFA_ENCRYPTION_KEY.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - userID: The ID of the user.
+//
+// Returns:
+//   - *models.TOTPEnrollmentResponse: The secret and the otpauth:// URI to import it into an authenticator app.
+//   - int: The HTTP status code indicating the result of the operation.
+//   - error: An error message if the operation fails.
+func (r *AuthRepo) EnrollTOTP(ctx context.Context, userID int) (*models.TOTPEnrollmentResponse, int, error) {
+	mfa, err := r.fetchUserMFA(ctx, userID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	if mfa != nil && mfa.enabledAt != nil {
+		return nil, http.StatusConflict, fmt.Errorf("two-factor authentication is already enabled")
+	}
+
+	var email string
+	if err := r.db.QueryRowContext(ctx, FETCH_USER_EMAIL, userID).Scan(&email); err != nil {
+		utils.Log.ErrorContext(ctx, "error on fetching user", "function", "EnrollTOTP", "error", err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+
+	secret, err := otp.GenerateSecret()
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on generating totp secret", "function", "EnrollTOTP", "error", err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	encryptedSecret, err := secrets.Encrypt([]byte(secret))
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on encrypting totp secret", "function", "EnrollTOTP", "error", err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	if _, err := r.db.ExecContext(ctx, UPSERT_USER_MFA, userID, encryptedSecret); err != nil {
+		utils.Log.ErrorContext(ctx, "error on saving totp secret", "function", "EnrollTOTP", "error", err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+
+	return &models.TOTPEnrollmentResponse{
+		Secret: secret,
+		URI:    otp.URI(config.Envs.MFA_ISSUER, email, secret),
+	}, http.StatusOK, nil
+}
+
+// ConfirmTOTP enables two-factor authentication once the user proves with a code that the authenticator app
+// was set up. It returns a new set of single-use recovery codes, which are shown only this once.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - userID: The ID of the user.
+//   - code: A current code of the authenticator app.
+//
+// Returns:
+//   - *models.RecoveryCodesResponse: The recovery codes.
+//   - int: The HTTP status code indicating the result of the operation.
+//   - error: An error message if the operation fails.
+func (r *AuthRepo) ConfirmTOTP(ctx context.Context, userID int, code string) (*models.RecoveryCodesResponse, int, error) {
+	mfa, err := r.fetchUserMFA(ctx, userID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	if mfa == nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("please start the enrollment first")
+	}
+	if mfa.enabledAt != nil {
+		return nil, http.StatusConflict, fmt.Errorf("two-factor authentication is already enabled")
+	}
+
+	secret, err := secrets.Decrypt(mfa.encryptedSecret)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on decrypting totp secret", "function", "ConfirmTOTP", "error", err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	step, ok := otp.Validate(string(secret), code, time.Now(), totpSkew)
+	if !ok {
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid code, please check the time of your device and try again")
+	}
+
+	res, err := r.db.ExecContext(ctx, ENABLE_USER_MFA, step, userID)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on enabling mfa", "function", "ConfirmTOTP", "error", err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	if rows, err := res.RowsAffected(); err != nil || rows == 0 {
+		return nil, http.StatusConflict, fmt.Errorf("two-factor authentication is already enabled")
+	}
+
+	codes, err := r.replaceRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("two-factor authentication is enabled, but the recovery codes couldn't be created, please regenerate them")
+	}
+	r.recordSecurityEvent(ctx, userID, "", SECURITY_EVENT_MFA_ENABLED, "totp enabled")
+	return &models.RecoveryCodesResponse{RecoveryCodes: codes}, http.StatusOK, nil
+}
+
+// DisableTOTP turns two-factor authentication off after checking the password and a code of the user.
+// A wrong password counts as a failed login, like on ChangePassword.
+// The TOTP secret and all recovery codes are deleted. An unconfirmed enrollment is cancelled the same way.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - userID: The ID of the user.
+//   - password: The password of the user.
+//   - code: A code of the authenticator app or a recovery code.
+//
+// Returns:
+//   - int: The HTTP status code indicating the result of the operation.
+//   - error: An error message if the operation fails.
+func (r *AuthRepo) DisableTOTP(ctx context.Context, userID int, password string, code string) (int, error) {
+	var email, hashPassword string
+	err := r.db.QueryRowContext(ctx, FETCH_USER_EMAIL_AND_PASSWORD, userID).Scan(&email, &hashPassword)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on fetching user", "function", "DisableTOTP", "error", err)
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	if status, err := r.checkCurrentPassword(ctx, userID, email, hashPassword, password); err != nil {
+		return status, err
+	}
+	mfa, err := r.fetchUserMFA(ctx, userID)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	if mfa == nil {
+		return http.StatusBadRequest, fmt.Errorf("two-factor authentication is not enabled")
+	}
+	// An enrollment which was never confirmed doesn't protect anything yet, so it is dropped without a code.
+	if mfa.enabledAt != nil {
+		if code == "" {
+			return http.StatusBadRequest, fmt.Errorf("please provide a code")
+		}
+		if status, err := r.checkSecondFactor(ctx, userID, code); err != nil {
+			return status, err
+		}
+	}
+
+	if _, err := r.db.ExecContext(ctx, DELETE_USER_MFA, userID); err != nil {
+		utils.Log.ErrorContext(ctx, "error on deleting mfa", "function", "DisableTOTP", "error", err)
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	if _, err := r.db.ExecContext(ctx, DELETE_RECOVERY_CODES, userID); err != nil {
+		utils.Log.ErrorContext(ctx, "error on deleting recovery codes", "function", "DisableTOTP", "error", err)
+	}
+	r.recordSecurityEvent(ctx, userID, "", SECURITY_EVENT_MFA_DISABLED, "totp disabled")
+	return http.StatusOK, nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of a user, used or not, with a new set.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - userID: The ID of the user.
+//   - code: A code of the authenticator app or a recovery code.
+//
+// Returns:
+//   - *models.RecoveryCodesResponse: The new recovery codes.
+//   - int: The HTTP status code indicating the result of the operation.
+//   - error: An error message if the operation fails.
+func (r *AuthRepo) RegenerateRecoveryCodes(ctx context.Context, userID int, code string) (*models.RecoveryCodesResponse, int, error) {
+	mfa, err := r.fetchUserMFA(ctx, userID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	if mfa == nil || mfa.enabledAt == nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("two-factor authentication is not enabled")
+	}
+	if status, err := r.checkSecondFactor(ctx, userID, code); err != nil {
+		return nil, status, err
+	}
+	codes, err := r.replaceRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	r.recordSecurityEvent(ctx, userID, "", SECURITY_EVENT_RECOVERY_CODES_NEW, "recovery codes regenerated")
+	return &models.RecoveryCodesResponse{RecoveryCodes: codes}, http.StatusOK, nil
+}
+
+// LoginMFA finishes the login of a user with two-factor authentication. The mfa_pending token returned by
+// LoginUser proves the password was correct, the code proves the second factor. Wrong codes count towards
+// the same backoff and lockout as wrong passwords, but separately from them. The mfa_pending token can
+// only be used for one successful login.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - mfaToken: The mfa_pending token returned by LoginUser.
+//   - code: A code of the authenticator app or a recovery code.
+//
+// Returns:
+//   - *models.TokenResponse: The authentication tokens of the new session.
+//   - int: The HTTP status code indicating the result of the operation.
+//   - error: An error message if the operation fails.
+func (r *AuthRepo) LoginMFA(ctx context.Context, mfaToken string, code string) (*models.TokenResponse, int, error) {
+	userID, _, err := r.peekUserToken(ctx, mfaToken, utils.MFAPendingTokenType)
+	if err == nil {
+		if status, err := r.checkSecondFactor(ctx, userID, code); err != nil {
+			return nil, status, err
+		}
+		_, _, err = r.consumeUserToken(ctx, mfaToken, utils.MFAPendingTokenType)
+	}
+	if err != nil {
+		if err == errInvalidUserToken {
+			return nil, http.StatusUnauthorized, fmt.Errorf("invalid or expired login, please login again")
+		}
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+
+	sessionID, err := newSessionID()
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on generating session id", "function", "LoginMFA", "error", err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	return r.getAuthTokens(ctx, userID, sessionID)
+}
+
+// mfaPendingLogin returns the response of a login with a correct password when the user has two-factor
+// authentication enabled: a short-lived mfa_pending token instead of the session tokens.
+// It returns nil if the user doesn't have two-factor authentication enabled. Without MFA_ENCRYPTION_KEY
+// the codes of such a user can't be checked, so the login fails instead of handing out a token which
+// can never be redeemed, or skipping the second factor.
+func (r *AuthRepo) mfaPendingLogin(ctx context.Context, userID int) (*models.TokenResponse, error) {
+	mfa, err := r.fetchUserMFA(ctx, userID)
+	if err != nil || mfa == nil || mfa.enabledAt == nil {
+		return nil, err
+	}
+	if len(config.Envs.MFA_ENCRYPTION_KEY) == 0 {
+		err := fmt.Errorf("MFA_ENCRYPTION_KEY is not set")
+		utils.Log.ErrorContext(ctx, "user has two-factor authentication enabled, but MFA_ENCRYPTION_KEY is not set", "function", "mfaPendingLogin", "userID", userID, "error", err)
+		return nil, err
+	}
+	token, err := r.issueUserToken(ctx, userID, utils.MFAPendingTokenType, time.Duration(config.Envs.MFA_PENDING_EXPIRE)*time.Minute, "")
+	if err != nil {
+		return nil, err
+	}
+	return &models.TokenResponse{MFAToken: token}, nil
+}
+
+// checkSecondFactor checks a code of the authenticator app or a recovery code of a user with two-factor
+// authentication enabled. Wrong codes are counted with the login policy, so guessing codes is slowed down
+// and eventually locked out just like guessing passwords.
+func (r *AuthRepo) checkSecondFactor(ctx context.Context, userID int, code string) (int, error) {
+	key := mfaAttemptKey(userID)
+	attempts, err := r.attempts.Get(ctx, key)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	now := time.Now()
+	if attempts.IsBlocked(now) {
+		return http.StatusTooManyRequests, fmt.Errorf("too many invalid codes, please try again in %d seconds", attempts.BlockedUntil-now.Unix())
+	}
+
+	ok, err := r.verifySecondFactor(ctx, userID, code)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	if !ok {
+		policy := loginPolicy()
+		attempts, err := r.attempts.Fail(ctx, key, policy)
+		if err == nil && attempts.Failures == policy.LockoutThreshold {
+			utils.Log.WarnContext(ctx, "second factor locked after invalid codes", "function", "checkSecondFactor", "userID", userID)
+			r.recordSecurityEvent(ctx, userID, "", SECURITY_EVENT_MFA_LOCKED, fmt.Sprintf("locked after %d invalid codes, last from %s", attempts.Failures, clientIP(ctx)))
+		}
+		return http.StatusUnauthorized, fmt.Errorf("invalid code, please try again")
+	}
+	r.attempts.Reset(ctx, key)
+	return http.StatusOK, nil
+}
+
+// verifySecondFactor reports whether a code is a valid TOTP code or an unused recovery code of the user.
+// Every TOTP code is accepted only once and no code older than the last accepted one, so an observed code
+// can't be replayed. A recovery code is used up by a successful check.
+func (r *AuthRepo) verifySecondFactor(ctx context.Context, userID int, code string) (bool, error) {
+	mfa, err := r.fetchUserMFA(ctx, userID)
+	if err != nil || mfa == nil || mfa.enabledAt == nil {
+		return false, err
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == otp.Digits {
+		secret, err := secrets.Decrypt(mfa.encryptedSecret)
+		if err != nil {
+			utils.Log.ErrorContext(ctx, "error on decrypting totp secret", "function", "verifySecondFactor", "error", err)
+			return false, err
+		}
+		step, ok := otp.Validate(string(secret), code, time.Now(), totpSkew)
+		if !ok || step <= mfa.lastUsedStep {
+			return false, nil
+		}
+		res, err := r.db.ExecContext(ctx, USE_TOTP_STEP, step, userID, step)
+		if err != nil {
+			utils.Log.ErrorContext(ctx, "error on using totp code", "function", "verifySecondFactor", "error", err)
+			return false, err
+		}
+		rows, err := res.RowsAffected()
+		return err == nil && rows > 0, err
+	}
+
+	res, err := r.db.ExecContext(ctx, USE_RECOVERY_CODE, userID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on using recovery code", "function", "verifySecondFactor", "error", err)
+		return false, err
+	}
+	if rows, err := res.RowsAffected(); err != nil || rows == 0 {
+		return false, err
+	}
+	var left int
+	if err := r.db.QueryRowContext(ctx, COUNT_RECOVERY_CODES, userID).Scan(&left); err != nil {
+		utils.Log.ErrorContext(ctx, "error on counting recovery codes", "function", "verifySecondFactor", "error", err)
+	}
+	r.recordSecurityEvent(ctx, userID, "", SECURITY_EVENT_RECOVERY_CODE_USED, fmt.Sprintf("recovery code used, %d left", left))
+	return true, nil
+}
+
+// fetchUserMFA returns the second factor of a user, or nil if the user never enrolled one.
+func (r *AuthRepo) fetchUserMFA(ctx context.Context, userID int) (*userMFA, error) {
+	mfa := &userMFA{}
+	err := r.db.QueryRowContext(ctx, FETCH_USER_MFA, userID).Scan(&mfa.encryptedSecret, &mfa.lastUsedStep, &mfa.enabledAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		utils.Log.ErrorContext(ctx, "error on fetching mfa", "function", "fetchUserMFA", "error", err)
+		return nil, err
+	}
+	return mfa, nil
+}
+
+// replaceRecoveryCodes deletes the recovery codes of a user and creates a new set. Only the hashes
+// of the codes are stored, the plaintext codes are returned to be shown to the user once.
+func (r *AuthRepo) replaceRecoveryCodes(ctx context.Context, userID int) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			utils.Log.ErrorContext(ctx, "error on generating recovery code", "function", "replaceRecoveryCodes", "error", err)
+			return nil, err
+		}
+		codes[i] = code
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on starting transaction", "function", "replaceRecoveryCodes", "error", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, DELETE_RECOVERY_CODES, userID); err != nil {
+		utils.Log.ErrorContext(ctx, "error on deleting recovery codes", "function", "replaceRecoveryCodes", "error", err)
+		return nil, err
+	}
+	for _, code := range codes {
+		if _, err := tx.ExecContext(ctx, INSERT_RECOVERY_CODE, userID, hashToken(normalizeRecoveryCode(code))); err != nil {
+			utils.Log.ErrorContext(ctx, "error on saving recovery code", "function", "replaceRecoveryCodes", "error", err)
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		utils.Log.ErrorContext(ctx, "error on saving recovery codes", "function", "replaceRecoveryCodes", "error", err)
+		return nil, err
+	}
+	return codes, nil
+}
+
+// newRecoveryCode returns a random recovery code like "abcde-fgh23", which is easy to write down.
+func newRecoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeLength*5/8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := recoveryCodeEncoding.EncodeToString(b)
+	return code[:recoveryCodeLength/2] + "-" + code[recoveryCodeLength/2:], nil
+}
+
+// normalizeRecoveryCode ignores the case and separators of a recovery code, which are easily mistyped.
+func normalizeRecoveryCode(code string) string {
+	return strings.Map(func(c rune) rune {
+		if c == '-' || c == ' ' {
+			return -1
+		}
+		return c
+	}, strings.ToLower(code))
+}
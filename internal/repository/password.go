@@ -0,0 +1,202 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/config"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/hasher"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/mailer"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/utils"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/validator"
+)
+
+const (
+	FETCH_USER_ID_BY_EMAIL = `SELECT id FROM users WHERE email = ?`
+	UPDATE_USER_PASSWORD   = `UPDATE users SET password = ? WHERE id = ?`
+)
+
+// ForgotPassword emails a short-lived, single-use link to reset the password of an account.
+// To not reveal which email addresses have an account, it always succeeds right away: looking up the account
+// and sending the email happen in the background, so neither the response time nor an error tells an existing
+// account from an unknown one. No email is sent to unknown addresses, or when PASSWORD_RESET_MAX_PER_HOUR
+// links were already sent to the address within the last hour.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - email: The email address of the account.
+//
+// Returns:
+//   - int: The HTTP status code indicating the result of the operation.
+//   - error: An error message if the operation fails.
+func (r *AuthRepo) ForgotPassword(ctx context.Context, email string) (int, error) {
+	inBackground(ctx, func(ctx context.Context) {
+		r.sendPasswordReset(ctx, email)
+	})
+	return http.StatusOK, nil
+}
+
+// sendPasswordReset emails a password reset link to the account of the email address, if there is one.
+// It runs in the background, so errors are only logged.
+func (r *AuthRepo) sendPasswordReset(ctx context.Context, email string) {
+	var userID int
+	err := r.db.QueryRowContext(ctx, FETCH_USER_ID_BY_EMAIL, email).Scan(&userID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			utils.Log.ErrorContext(ctx, "error on fetching user", "function", "sendPasswordReset", "error", err)
+		}
+		return
+	}
+
+	count, err := r.countRecentUserTokens(ctx, userID, utils.PasswordResetTokenType, time.Now().Add(-time.Hour))
+	if err != nil {
+		return
+	}
+	if count >= config.Envs.PASSWORD_RESET_MAX_PER_HOUR {
+		utils.Log.WarnContext(ctx, "password reset limit reached", "function", "sendPasswordReset", "userID", userID)
+		return
+	}
+
+	token, err := r.issueUserToken(ctx, userID, utils.PasswordResetTokenType, time.Duration(config.Envs.PASSWORD_RESET_EXPIRE)*time.Minute, "")
+	if err != nil {
+		return
+	}
+	r.mailer.Send(ctx, mailer.NewPasswordResetEmail(email, token))
+}
+
+// ResetPassword sets a new password using the single-use token from the reset email.
+// The new password has to satisfy the password policy, which is checked before the token is used up.
+// All other reset links of the user stop working and every session of the user is logged out, including its access tokens,
+// so whoever knew the old password loses access. As the link was opened from the inbox, the email
+// address counts as verified afterwards.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - token: The reset token from the email.
+//   - password: The new password.
+//
+// Returns:
+//   - int: The HTTP status code indicating the result of the operation.
+//   - error: An error message if the operation fails.
+func (r *AuthRepo) ResetPassword(ctx context.Context, token string, password string) (int, error) {
+	userID, _, err := r.peekUserToken(ctx, token, utils.PasswordResetTokenType)
+	if err == nil {
+		var email string
+		if err = r.db.QueryRowContext(ctx, FETCH_USER_EMAIL, userID).Scan(&email); err == nil {
+			if err := validator.CheckPassword("password", password, email); err != nil {
+				return http.StatusBadRequest, err
+			}
+			_, _, err = r.consumeUserToken(ctx, token, utils.PasswordResetTokenType)
+		}
+	}
+	if err != nil {
+		if err == errInvalidUserToken || err == sql.ErrNoRows {
+			return http.StatusBadRequest, fmt.Errorf("invalid or expired link, please request a new one")
+		}
+		utils.Log.ErrorContext(ctx, "error on using reset token", "function", "ResetPassword", "error", err)
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+
+	hashPassword, err := getHashPassword(password)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on generating hash password", "function", "ResetPassword", "error", err)
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	_, err = r.db.ExecContext(ctx, UPDATE_USER_PASSWORD, hashPassword, userID)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on updating password", "function", "ResetPassword", "error", err)
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+
+	// The password is already changed at this point, so the remaining steps only log their errors.
+	r.invalidateUserTokens(ctx, userID, utils.PasswordResetTokenType)
+	if err := r.revokeUserSessions(ctx, userID, ""); err != nil {
+		utils.Log.ErrorContext(ctx, "error on revoking user sessions", "function", "ResetPassword", "error", err)
+	}
+	if _, err := r.db.ExecContext(ctx, DELETE_USER_SESSIONS, userID); err != nil {
+		utils.Log.ErrorContext(ctx, "error on deleting user sessions", "function", "ResetPassword", "error", err)
+	}
+	if _, err := r.db.ExecContext(ctx, UPDATE_USER_EMAIL_VERIFIED, userID); err != nil {
+		utils.Log.ErrorContext(ctx, "error on verifying user email", "function", "ResetPassword", "error", err)
+	}
+	r.recordSecurityEvent(ctx, userID, "", SECURITY_EVENT_PASSWORD_RESET, "password reset by email, all sessions logged out")
+	return http.StatusOK, nil
+}
+
+// ChangePassword replaces the password of a logged in user after checking their current password.
+// A wrong current password counts as a failed login, so the backoff delays and the lockout apply.
+// The new password has to satisfy the password policy.
+// Unused reset links of the user stop working. When signOutOthers is set, every session of the user
+// except the current one is logged out and their access tokens are revoked.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - userID: The ID of the user.
+//   - sessionID: The ID of the session the request was made with, which stays logged in.
+//   - currentPassword: The current password of the user.
+//   - newPassword: The new password.
+//   - signOutOthers: Whether to log out the other sessions of the user.
+//
+// Returns:
+//   - int: The HTTP status code indicating the result of the operation.
+//   - error: An error message if the operation fails.
+func (r *AuthRepo) ChangePassword(ctx context.Context, userID int, sessionID string, currentPassword string, newPassword string, signOutOthers bool) (int, error) {
+	var email, hashPassword string
+	err := r.db.QueryRowContext(ctx, FETCH_USER_EMAIL_AND_PASSWORD, userID).Scan(&email, &hashPassword)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on fetching user", "function", "ChangePassword", "error", err)
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	if status, err := r.checkCurrentPassword(ctx, userID, email, hashPassword, currentPassword); err != nil {
+		return status, err
+	}
+	if err := validator.CheckPassword("new_password", newPassword, email); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	hashPassword, err = getHashPassword(newPassword)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on generating hash password", "function", "ChangePassword", "error", err)
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	_, err = r.db.ExecContext(ctx, UPDATE_USER_PASSWORD, hashPassword, userID)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on updating password", "function", "ChangePassword", "error", err)
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+
+	r.invalidateUserTokens(ctx, userID, utils.PasswordResetTokenType)
+	details := "password changed"
+	if signOutOthers {
+		if err := r.revokeUserSessions(ctx, userID, sessionID); err != nil {
+			return http.StatusInternalServerError, fmt.Errorf("password changed, but other sessions couldn't be logged out, please try again later")
+		}
+		if _, err := r.db.ExecContext(ctx, DELETE_OTHER_USER_SESSIONS, userID, sessionID); err != nil {
+			utils.Log.ErrorContext(ctx, "error on deleting user sessions", "function", "ChangePassword", "error", err)
+			return http.StatusInternalServerError, fmt.Errorf("password changed, but other sessions couldn't be logged out, please try again later")
+		}
+		details = "password changed, other sessions logged out"
+	}
+	r.recordSecurityEvent(ctx, userID, sessionID, SECURITY_EVENT_PASSWORD_CHANGE, details)
+	return http.StatusOK, nil
+}
+
+// rehashPassword replaces a stored password hash which was made with another algorithm or other parameters
+// than the current PASSWORD_HASHER settings. It needs the plaintext password, so it runs on a successful login.
+// The login must not fail because of it, so errors are only logged.
+func (r *AuthRepo) rehashPassword(ctx context.Context, userID int, hashPassword string, password string) {
+	if !hasher.NewPasswordHasher().NeedsRehash(hashPassword) {
+		return
+	}
+	newHashPassword, err := getHashPassword(password)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on generating hash password", "function", "rehashPassword", "error", err)
+		return
+	}
+	if _, err := r.db.ExecContext(ctx, UPDATE_USER_PASSWORD, newHashPassword, userID); err != nil {
+		utils.Log.ErrorContext(ctx, "error on updating password", "function", "rehashPassword", "error", err)
+	}
+}
@@ -0,0 +1,295 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/config"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/mailer"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/models"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/utils"
+)
+
+// RequestMagicLink emails a short-lived, single-use link which logs the user in without a password.
+// The link is bound to the requesting browser by a random nonce: only its hash is stored with the link token,
+// the nonce itself is returned to be set as a cookie and has to be presented along with the link.
+// To not reveal which email addresses have an account, it always succeeds right away with a new nonce:
+// looking up the account and sending the email happen in the background, like on ForgotPassword. No email is
+// sent to unknown addresses, or when MAGIC_LINK_MAX_PER_HOUR links were already sent to the address within
+// the last hour.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - email: The email address of the account.
+//
+// Returns:
+//   - *models.MagicLinkResponse: The nonce binding the link to the browser.
+//   - int: The HTTP status code indicating the result of the operation.
+//   - error: An error message if the operation fails.
+func (r *AuthRepo) RequestMagicLink(ctx context.Context, email string) (*models.MagicLinkResponse, int, error) {
+	nonce, err := newSessionID()
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on generating nonce", "function", "RequestMagicLink", "error", err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	inBackground(ctx, func(ctx context.Context) {
+		r.sendMagicLink(ctx, email, nonce)
+	})
+	return &models.MagicLinkResponse{Nonce: nonce}, http.StatusOK, nil
+}
+
+// sendMagicLink emails a magic link bound to the nonce to the account of the email address, if there is one.
+// It runs in the background, so errors are only logged.
+func (r *AuthRepo) sendMagicLink(ctx context.Context, email string, nonce string) {
+	var userID int
+	err := r.db.QueryRowContext(ctx, FETCH_USER_ID_BY_EMAIL, email).Scan(&userID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			utils.Log.ErrorContext(ctx, "error on fetching user", "function", "sendMagicLink", "error", err)
+		}
+		return
+	}
+
+	count, err := r.countRecentUserTokens(ctx, userID, utils.MagicLinkTokenType, time.Now().Add(-time.Hour))
+	if err != nil {
+		return
+	}
+	if count >= config.Envs.MAGIC_LINK_MAX_PER_HOUR {
+		utils.Log.WarnContext(ctx, "magic link limit reached", "function", "sendMagicLink", "userID", userID)
+		return
+	}
+
+	validFor := time.Duration(config.Envs.MAGIC_LINK_EXPIRE) * time.Minute
+	token, err := r.issueUserToken(ctx, userID, utils.MagicLinkTokenType, validFor, hashToken(nonce))
+	if err != nil {
+		return
+	}
+	r.mailer.Send(ctx, mailer.NewMagicLinkEmail(email, token, validFor))
+}
+
+// VerifyMagicLink exchanges the token of a magic link for a new session, like LoginUser. It only works
+// together with the nonce of the browser the link was requested from, so a link leaked from the inbox
+// can't be used elsewhere. The other magic links of the user stop working, and as the link was opened from
+// the inbox, the email address counts as verified afterwards. Users with two-factor authentication enabled
+// get an mfa_pending token instead of the session tokens.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - token: The token of the magic link.
+//   - nonce: The nonce from the cookie set by RequestMagicLink.
+//
+// Returns:
+//   - *models.TokenResponse: The authentication tokens or the mfa_pending token.
+//   - int: The HTTP status code indicating the result of the operation.
+//   - error: An error message if the operation fails.
+func (r *AuthRepo) VerifyMagicLink(ctx context.Context, token string, nonce string) (*models.TokenResponse, int, error) {
+	userID, nonceHash, err := r.peekUserToken(ctx, token, utils.MagicLinkTokenType)
+	if err == nil {
+		if nonce == "" || subtle.ConstantTimeCompare([]byte(hashToken(nonce)), []byte(nonceHash)) != 1 {
+			return nil, http.StatusUnauthorized, fmt.Errorf("please open the link in the browser you requested it from")
+		}
+		_, _, err = r.consumeUserToken(ctx, token, utils.MagicLinkTokenType)
+	}
+	if err != nil {
+		if err == errInvalidUserToken {
+			return nil, http.StatusUnauthorized, fmt.Errorf("invalid or expired link, please request a new one")
+		}
+		utils.Log.ErrorContext(ctx, "error on using magic link", "function", "VerifyMagicLink", "error", err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+
+	r.invalidateUserTokens(ctx, userID, utils.MagicLinkTokenType)
+	if _, err := r.db.ExecContext(ctx, UPDATE_USER_EMAIL_VERIFIED, userID); err != nil {
+		utils.Log.ErrorContext(ctx, "error on verifying user email", "function", "VerifyMagicLink", "error", err)
+	}
+
+	mfaResponse, err := r.mfaPendingLogin(ctx, userID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	if mfaResponse != nil {
+		return mfaResponse, http.StatusOK, nil
+	}
+
+	sessionID, err := newSessionID()
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on generating session id", "function", "VerifyMagicLink", "error", err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	return r.getAuthTokens(ctx, userID, sessionID)
+}
+
+// emailOTPPolicy counts the invalid guesses of the current email login code. Only the number of failures
+// is used: after EMAIL_OTP_MAX_ATTEMPTS of them the code stops working, while waiting and locking is left to
+// the login policy of the account.
+func emailOTPPolicy() *AttemptPolicy {
+	return &AttemptPolicy{
+		Window:       time.Duration(config.Envs.EMAIL_OTP_EXPIRE) * time.Minute,
+		BackoffAfter: config.Envs.EMAIL_OTP_MAX_ATTEMPTS,
+	}
+}
+
+func emailOTPAttemptKey(userID int) string {
+	return "email_otp:user:" + strconv.Itoa(userID)
+}
+
+// newEmailOTP returns a random 6-digit code.
+func newEmailOTP() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// RequestEmailOTP emails a 6-digit code which logs the user in without a password, for clients which
+// can't conveniently open a magic link. Only the latest code of a user works, for EMAIL_OTP_EXPIRE minutes,
+// and only its hash is stored. To not reveal which email addresses have an account, it always succeeds right
+// away: looking up the account and sending the email happen in the background, like on ForgotPassword. No email
+// is sent to unknown addresses, or when EMAIL_OTP_MAX_PER_HOUR codes were already sent to the address within
+// the last hour.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - email: The email address of the account.
+//
+// Returns:
+//   - int: The HTTP status code indicating the result of the operation.
+//   - error: An error message if the operation fails.
+func (r *AuthRepo) RequestEmailOTP(ctx context.Context, email string) (int, error) {
+	inBackground(ctx, func(ctx context.Context) {
+		r.sendEmailOTP(ctx, email)
+	})
+	return http.StatusOK, nil
+}
+
+// sendEmailOTP emails a new login code to the account of the email address, if there is one.
+// It runs in the background, so errors are only logged.
+func (r *AuthRepo) sendEmailOTP(ctx context.Context, email string) {
+	var userID int
+	err := r.db.QueryRowContext(ctx, FETCH_USER_ID_BY_EMAIL, email).Scan(&userID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			utils.Log.ErrorContext(ctx, "error on fetching user", "function", "sendEmailOTP", "error", err)
+		}
+		return
+	}
+
+	count, err := r.countRecentUserTokens(ctx, userID, utils.EmailOTPTokenType, time.Now().Add(-time.Hour))
+	if err != nil {
+		return
+	}
+	if count >= config.Envs.EMAIL_OTP_MAX_PER_HOUR {
+		utils.Log.WarnContext(ctx, "email login code limit reached", "function", "sendEmailOTP", "userID", userID)
+		return
+	}
+
+	code, err := newEmailOTP()
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on generating code", "function", "sendEmailOTP", "error", err)
+		return
+	}
+	if err := r.invalidateUserTokens(ctx, userID, utils.EmailOTPTokenType); err != nil {
+		return
+	}
+	r.attempts.Reset(ctx, emailOTPAttemptKey(userID))
+
+	// The code is looked up by the user, so the token itself is never handed out, it only carries
+	// the expiry and the single use of the code.
+	validFor := time.Duration(config.Envs.EMAIL_OTP_EXPIRE) * time.Minute
+	if _, err := r.issueUserToken(ctx, userID, utils.EmailOTPTokenType, validFor, hashToken(code)); err != nil {
+		return
+	}
+	r.mailer.Send(ctx, mailer.NewEmailOTPEmail(email, code, validFor))
+}
+
+// VerifyEmailOTP logs a user in with the code from RequestEmailOTP, like LoginUser. An invalid code counts
+// as a failed login of the account and of the IP address, so the backoff delays and the lockout of LoginUser
+// apply to guessing codes as well. After EMAIL_OTP_MAX_ATTEMPTS invalid codes the current code stops working
+// and a new one has to be requested. As the code was read from the inbox, the email address counts as
+// verified afterwards. Users with two-factor authentication enabled get an mfa_pending token instead of the
+// session tokens.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - email: The email address of the account.
+//   - code: The code from the email.
+//
+// Returns:
+//   - *models.TokenResponse: The authentication tokens or the mfa_pending token.
+//   - int: The HTTP status code indicating the result of the operation.
+//   - error: An error message if the operation fails.
+func (r *AuthRepo) VerifyEmailOTP(ctx context.Context, email string, code string) (*models.TokenResponse, int, error) {
+	if status, err := r.checkLoginIP(ctx); err != nil {
+		return nil, status, err
+	}
+
+	var userID int
+	err := r.db.QueryRowContext(ctx, FETCH_USER_ID_BY_EMAIL, email).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			r.recordLoginFailure(ctx, 0, "")
+			return nil, http.StatusUnauthorized, fmt.Errorf("invalid or expired code, please try again")
+		}
+		utils.Log.ErrorContext(ctx, "error on fetching user", "function", "VerifyEmailOTP", "error", err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+
+	// The block is checked before the code, otherwise guessing could go on during the block.
+	if status, err := r.checkLoginAccount(ctx, userID); err != nil {
+		return nil, status, err
+	}
+
+	tokenHash, codeHash, err := r.latestUserToken(ctx, userID, utils.EmailOTPTokenType)
+	if err != nil && err != errInvalidUserToken {
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	if err == errInvalidUserToken || subtle.ConstantTimeCompare([]byte(hashToken(code)), []byte(codeHash)) != 1 {
+		r.recordLoginFailure(ctx, userID, email)
+		if err == nil {
+			attempts, err := r.attempts.Fail(ctx, emailOTPAttemptKey(userID), emailOTPPolicy())
+			if err == nil && attempts.Failures >= config.Envs.EMAIL_OTP_MAX_ATTEMPTS {
+				r.invalidateUserTokens(ctx, userID, utils.EmailOTPTokenType)
+				r.attempts.Reset(ctx, emailOTPAttemptKey(userID))
+				return nil, http.StatusUnauthorized, fmt.Errorf("too many invalid codes, please request a new one")
+			}
+		}
+		return nil, http.StatusUnauthorized, fmt.Errorf("invalid or expired code, please try again")
+	}
+
+	res, err := r.db.ExecContext(ctx, USE_USER_TOKEN, tokenHash, utils.EmailOTPTokenType, time.Now().Unix())
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on using code", "function", "VerifyEmailOTP", "error", err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	if rows, err := res.RowsAffected(); err != nil || rows == 0 {
+		return nil, http.StatusUnauthorized, fmt.Errorf("invalid or expired code, please try again")
+	}
+	r.attempts.Reset(ctx, emailOTPAttemptKey(userID))
+	r.attempts.Reset(ctx, userAttemptKey(userID))
+	if _, err := r.db.ExecContext(ctx, UPDATE_USER_EMAIL_VERIFIED, userID); err != nil {
+		utils.Log.ErrorContext(ctx, "error on verifying user email", "function", "VerifyEmailOTP", "error", err)
+	}
+
+	mfaResponse, err := r.mfaPendingLogin(ctx, userID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	if mfaResponse != nil {
+		return mfaResponse, http.StatusOK, nil
+	}
+
+	sessionID, err := newSessionID()
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on generating session id", "function", "VerifyEmailOTP", "error", err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	return r.getAuthTokens(ctx, userID, sessionID)
+}
@@ -4,14 +4,54 @@ import (
 	"context"
 
 	"github.com/the-arcade-01/golang-jwt-authentication/internal/models"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/webauthn"
 )
 
 type AuthRepositoryInterface interface {
 	CreateUser(ctx context.Context, user *models.User) (int, error)
-	LogoutUser(ctx context.Context, userID int) (int, error)
-	DeleteUser(ctx context.Context, userID int) (int, error)
+	LogoutUser(ctx context.Context, userID int, sessionID string, accessTokenID string, accessTokenExpire int64) (int, error)
+	RevokeAccessToken(ctx context.Context, accessTokenID string, accessTokenExpire int64) (int, error)
+	DeleteUser(ctx context.Context, userID int, accessTokenID string, accessTokenExpire int64) (int, error)
 	GetUserByID(ctx context.Context, userID int) (*models.User, int, error)
 	LoginUser(ctx context.Context, user *models.User) (*models.TokenResponse, int, error)
-	GenerateTokens(ctx context.Context, userID int, oldRefreshToken string) (*models.TokenResponse, int, error)
-	getAuthTokens(ctx context.Context, userID int) (*models.TokenResponse, int, error)
+	GenerateTokens(ctx context.Context, oldRefreshToken string) (*models.TokenResponse, int, error)
+	IntrospectToken(ctx context.Context, tokenString string, tokenTypeHint string) (*models.IntrospectionResponse, int, error)
+	RevokeToken(ctx context.Context, tokenString string, tokenTypeHint string) (int, error)
+	VerifyEmail(ctx context.Context, token string) (int, error)
+	ResendVerificationEmail(ctx context.Context, email string) (int, error)
+	ForgotPassword(ctx context.Context, email string) (int, error)
+	ResetPassword(ctx context.Context, token string, password string) (int, error)
+	ChangePassword(ctx context.Context, userID int, sessionID string, currentPassword string, newPassword string, signOutOthers bool) (int, error)
+	RequestEmailChange(ctx context.Context, userID int, password string, newEmail string) (int, error)
+	ConfirmEmailChange(ctx context.Context, token string) (int, error)
+	CancelEmailChange(ctx context.Context, token string) (int, error)
+	UnlockAccount(ctx context.Context, token string) (int, error)
+	UnlockUser(ctx context.Context, userID int) (int, error)
+	EnrollTOTP(ctx context.Context, userID int) (*models.TOTPEnrollmentResponse, int, error)
+	ConfirmTOTP(ctx context.Context, userID int, code string) (*models.RecoveryCodesResponse, int, error)
+	DisableTOTP(ctx context.Context, userID int, password string, code string) (int, error)
+	RegenerateRecoveryCodes(ctx context.Context, userID int, code string) (*models.RecoveryCodesResponse, int, error)
+	LoginMFA(ctx context.Context, mfaToken string, code string) (*models.TokenResponse, int, error)
+	BeginWebAuthnRegistration(ctx context.Context, userID int) (*webauthn.CreationOptions, int, error)
+	FinishWebAuthnRegistration(ctx context.Context, userID int, name string, credential *webauthn.CredentialCreationResponse) (int, error)
+	BeginWebAuthnLogin(ctx context.Context, email string) (*webauthn.RequestOptions, int, error)
+	FinishWebAuthnLogin(ctx context.Context, credential *webauthn.CredentialAssertionResponse) (*models.TokenResponse, int, error)
+	GetWebAuthnCredentials(ctx context.Context, userID int) ([]*models.WebAuthnCredential, int, error)
+	DeleteWebAuthnCredential(ctx context.Context, userID int, credentialID int) (int, error)
+	RequestMagicLink(ctx context.Context, email string) (*models.MagicLinkResponse, int, error)
+	VerifyMagicLink(ctx context.Context, token string, nonce string) (*models.TokenResponse, int, error)
+	RequestEmailOTP(ctx context.Context, email string) (int, error)
+	VerifyEmailOTP(ctx context.Context, email string, code string) (*models.TokenResponse, int, error)
+	getAuthTokens(ctx context.Context, userID int, sessionID string) (*models.TokenResponse, int, error)
+}
+
+type AttemptStoreInterface interface {
+	Get(ctx context.Context, key string) (*Attempts, error)
+	Fail(ctx context.Context, key string, policy *AttemptPolicy) (*Attempts, error)
+	Reset(ctx context.Context, key string) error
+}
+
+type RevocationStoreInterface interface {
+	Revoke(ctx context.Context, jti string, expireTime int64) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
 }
@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/config"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/utils"
+)
+
+const (
+	INSERT_REVOKED_TOKEN = `
+		INSERT INTO revoked_tokens (jti, expire_time) 
+		VALUES (?, ?) 
+		ON DUPLICATE KEY UPDATE 
+		expire_time = VALUES(expire_time)
+	`
+	COUNT_REVOKED_TOKEN   = `SELECT count(jti) FROM revoked_tokens WHERE jti = ? AND expire_time > ?`
+	DELETE_REVOKED_TOKENS = `DELETE FROM revoked_tokens WHERE expire_time <= ?`
+)
+
+var (
+	revocationOnce  sync.Once
+	revocationStore RevocationStoreInterface
+)
+
+// NewRevocationStore returns the singleton access token revocation store selected by REVOCATION_STORE:
+// "memory" keeps revoked tokens in the process, "db" keeps them in the revoked_tokens table so every
+// instance of a multi-instance deployment sees them.
+func NewRevocationStore() RevocationStoreInterface {
+	revocationOnce.Do(func() {
+		switch config.Envs.REVOCATION_STORE {
+		case "db":
+			revocationStore = newDBRevocationStore(config.NewAppConfig().DB)
+		default:
+			revocationStore = newMemoryRevocationStore()
+		}
+	})
+	return revocationStore
+}
+
+// MemoryRevocationStore keeps the IDs of revoked tokens in memory until the tokens expire.
+type MemoryRevocationStore struct {
+	mu      sync.RWMutex
+	revoked map[string]int64
+}
+
+func newMemoryRevocationStore() *MemoryRevocationStore {
+	s := &MemoryRevocationStore{revoked: map[string]int64{}}
+	go purgeRevokedTokens(s.purge)
+	return s
+}
+
+// Revoke adds the token ID to the denylist until expireTime (Unix time).
+func (s *MemoryRevocationStore) Revoke(ctx context.Context, jti string, expireTime int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revoked[jti] = expireTime
+	return nil
+}
+
+// IsRevoked reports whether the token ID is on the denylist.
+func (s *MemoryRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	expireTime, ok := s.revoked[jti]
+	return ok && expireTime > time.Now().Unix(), nil
+}
+
+func (s *MemoryRevocationStore) purge(ctx context.Context, now int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for jti, expireTime := range s.revoked {
+		if expireTime <= now {
+			delete(s.revoked, jti)
+		}
+	}
+	return nil
+}
+
+// DBRevocationStore keeps the IDs of revoked tokens in the revoked_tokens table until the tokens expire.
+type DBRevocationStore struct {
+	db *sql.DB
+}
+
+func newDBRevocationStore(db *sql.DB) *DBRevocationStore {
+	s := &DBRevocationStore{db: db}
+	go purgeRevokedTokens(s.purge)
+	return s
+}
+
+// Revoke adds the token ID to the denylist until expireTime (Unix time).
+func (s *DBRevocationStore) Revoke(ctx context.Context, jti string, expireTime int64) error {
+	_, err := s.db.ExecContext(ctx, INSERT_REVOKED_TOKEN, jti, expireTime)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on saving revoked token", "function", "Revoke", "error", err)
+	}
+	return err
+}
+
+// IsRevoked reports whether the token ID is on the denylist.
+func (s *DBRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, COUNT_REVOKED_TOKEN, jti, time.Now().Unix()).Scan(&count)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on fetching revoked token", "function", "IsRevoked", "error", err)
+		return false, err
+	}
+	return count != 0, nil
+}
+
+func (s *DBRevocationStore) purge(ctx context.Context, now int64) error {
+	_, err := s.db.ExecContext(ctx, DELETE_REVOKED_TOKENS, now)
+	return err
+}
+
+// RevokedSessionKey returns the denylist entry which revokes every access token of a session at once,
+// as the IDs of the access tokens issued for a session aren't stored.
+func RevokedSessionKey(sessionID string) string {
+	return "sid:" + sessionID
+}
+
+// IsAccessTokenRevoked reports whether an access token is on the denylist, either by its own ID
+// or because its whole session was revoked.
+func IsAccessTokenRevoked(ctx context.Context, store RevocationStoreInterface, jti string, sessionID string) (bool, error) {
+	revoked, err := store.IsRevoked(ctx, jti)
+	if err != nil || revoked {
+		return revoked, err
+	}
+	return store.IsRevoked(ctx, RevokedSessionKey(sessionID))
+}
+
+// purgeRevokedTokens drops the entries of expired tokens once a minute, a revoked token
+// doesn't need to be remembered once it expired on its own.
+func purgeRevokedTokens(purge func(ctx context.Context, now int64) error) {
+	ticker := time.NewTicker(time.Minute)
+	for range ticker.C {
+		if err := purge(context.Background(), time.Now().Unix()); err != nil {
+			utils.Log.Error("error on purging revoked tokens", "function", "purgeRevokedTokens", "error", err)
+		}
+	}
+}
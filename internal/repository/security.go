@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/utils"
+)
+
+const (
+	INSERT_SECURITY_EVENT = `INSERT INTO security_events (user_id, session_id, event_type, details) VALUES (?, ?, ?, ?)`
+)
+
+const (
+	SECURITY_EVENT_REFRESH_TOKEN_REUSE = "refresh_token_reuse"
+	SECURITY_EVENT_PASSWORD_RESET      = "password_reset"
+	SECURITY_EVENT_PASSWORD_CHANGE     = "password_change"
+	SECURITY_EVENT_EMAIL_CHANGE        = "email_change"
+	SECURITY_EVENT_EMAIL_CHANGE_CANCEL = "email_change_cancel"
+	SECURITY_EVENT_ACCOUNT_LOCKED      = "account_locked"
+	SECURITY_EVENT_ACCOUNT_UNLOCKED    = "account_unlocked"
+	SECURITY_EVENT_MFA_ENABLED         = "mfa_enabled"
+	SECURITY_EVENT_MFA_DISABLED        = "mfa_disabled"
+	SECURITY_EVENT_MFA_LOCKED          = "mfa_locked"
+	SECURITY_EVENT_RECOVERY_CODE_USED  = "recovery_code_used"
+	SECURITY_EVENT_RECOVERY_CODES_NEW  = "recovery_codes_regenerated"
+	SECURITY_EVENT_PASSKEY_REGISTERED  = "passkey_registered"
+	SECURITY_EVENT_PASSKEY_REMOVED     = "passkey_removed"
+	SECURITY_EVENT_PASSKEY_CLONED      = "passkey_clone_detected"
+)
+
+// recordSecurityEvent stores a security relevant event of a user in the security_events table.
+// Failing to record the event must not fail the request that triggered it, so errors are only logged.
+func (r *AuthRepo) recordSecurityEvent(ctx context.Context, userID int, sessionID string, eventType string, details string) {
+	_, err := r.db.ExecContext(ctx, INSERT_SECURITY_EVENT, userID, sessionID, eventType, details)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on saving security event", "function", "recordSecurityEvent", "event", eventType, "error", err)
+	}
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/config"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/utils"
+)
+
+const (
+	FETCH_PLAINTEXT_REFRESH_TOKENS = `SELECT session_id, refresh_token FROM refresh_tokens_table WHERE refresh_token LIKE '%.%'`
+	UPDATE_REFRESH_TOKEN_HASH      = `UPDATE refresh_tokens_table SET refresh_token = ? WHERE session_id = ? AND refresh_token = ?`
+)
+
+// hashToken returns the hex encoded HMAC-SHA256 of a token keyed with the server side pepper.
+// Only this hash is stored in the database, so a database dump doesn't hand out usable tokens.
+func hashToken(token string) string {
+	mac := hmac.New(sha256.New, []byte(config.Envs.TOKEN_HASH_PEPPER))
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// tokenHashEqual compares two token hashes in constant time.
+func tokenHashEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// HashPlaintextRefreshTokens is a one-off migration which replaces refresh tokens that were stored
+// in plaintext before tokens got hashed with their hash. Plaintext rows are recognised by the dots of
+// the JWT, which a hex encoded hash never contains, so running it more than once is harmless.
+//
+// Returns the number of rows that were hashed.
+func HashPlaintextRefreshTokens(ctx context.Context) (int, error) {
+	db := config.NewAppConfig().DB
+	rows, err := db.QueryContext(ctx, FETCH_PLAINTEXT_REFRESH_TOKENS)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on fetching plaintext refresh tokens", "function", "HashPlaintextRefreshTokens", "error", err)
+		return 0, err
+	}
+	defer rows.Close()
+
+	plaintext := map[string]string{}
+	for rows.Next() {
+		var sessionID, token string
+		if err := rows.Scan(&sessionID, &token); err != nil {
+			return 0, err
+		}
+		plaintext[sessionID] = token
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	hashed := 0
+	for sessionID, token := range plaintext {
+		_, err := db.ExecContext(ctx, UPDATE_REFRESH_TOKEN_HASH, hashToken(token), sessionID, token)
+		if err != nil {
+			utils.Log.ErrorContext(ctx, "error on hashing refresh token", "function", "HashPlaintextRefreshTokens", "sessionID", sessionID, "error", err)
+			return hashed, err
+		}
+		hashed++
+	}
+	return hashed, nil
+}
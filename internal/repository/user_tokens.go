@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/config"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/utils"
+)
+
+const (
+	INSERT_USER_TOKEN = `INSERT INTO user_tokens (user_id, purpose, token_hash, data, expire_time) VALUES (?, ?, ?, ?, ?)`
+	USE_USER_TOKEN    = `
+		UPDATE user_tokens SET used_at = CURRENT_TIMESTAMP 
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expire_time > ?
+	`
+	RESTORE_USER_TOKEN       = `UPDATE user_tokens SET used_at = NULL WHERE token_hash = ? AND purpose = ?`
+	FETCH_USER_TOKEN         = `SELECT user_id, data FROM user_tokens WHERE token_hash = ? AND purpose = ?`
+	FETCH_USABLE_USER_TOKEN  = `SELECT user_id, data FROM user_tokens WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expire_time > ?`
+	COUNT_RECENT_USER_TOKENS = `SELECT count(id) FROM user_tokens WHERE user_id = ? AND purpose = ? AND created_at > ?`
+	INVALIDATE_USER_TOKENS   = `UPDATE user_tokens SET used_at = CURRENT_TIMESTAMP WHERE user_id = ? AND purpose = ? AND used_at IS NULL`
+	FETCH_LATEST_USER_TOKEN  = `
+		SELECT token_hash, data FROM user_tokens 
+		WHERE user_id = ? AND purpose = ? AND used_at IS NULL AND expire_time > ? 
+		ORDER BY id DESC LIMIT 1
+	`
+)
+
+// backgroundTimeout bounds the work started by inBackground.
+const backgroundTimeout = 30 * time.Second
+
+// errInvalidUserToken is returned for user tokens which are invalid, expired or already used.
+var errInvalidUserToken = fmt.Errorf("invalid or expired token")
+
+// issueUserToken creates a signed, single-use token for an action a user confirms out of band, e.g. by
+// opening a link from an email. The purpose is stored as the token's typ claim, so the token is only
+// accepted for that action and never as an access or refresh token. Only the hash of the token is stored,
+// together with optional data belonging to the action.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - userID: The ID of the user the token is issued for.
+//   - purpose: The action the token is for, e.g. utils.EmailVerificationTokenType.
+//   - ttl: How long the token stays valid.
+//   - data: Optional data of the action, returned by consumeUserToken.
+//
+// Returns:
+//   - string: The signed token.
+//   - error: An error if the token couldn't be created.
+func (r *AuthRepo) issueUserToken(ctx context.Context, userID int, purpose string, ttl time.Duration, data string) (string, error) {
+	jti, err := newSessionID()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	expireTime := now.Add(ttl).Unix()
+	token, err := r.auth.Encode(map[string]any{
+		"iss": config.Envs.JWT_ISSUER,
+		"aud": config.Envs.JWT_AUDIENCE,
+		"sub": strconv.Itoa(userID),
+		"iat": now.Unix(),
+		"exp": expireTime,
+		"jti": jti,
+		"typ": purpose,
+	})
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on generating user token", "function", "issueUserToken", "purpose", purpose, "error", err)
+		return "", err
+	}
+
+	_, err = r.db.ExecContext(ctx, INSERT_USER_TOKEN, userID, purpose, hashToken(token), data, expireTime)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on saving user token", "function", "issueUserToken", "purpose", purpose, "error", err)
+		return "", err
+	}
+	return token, nil
+}
+
+// consumeUserToken verifies a token created by issueUserToken for the given purpose and marks it as used,
+// so it can't be used a second time. It returns errInvalidUserToken for tokens which are invalid, expired,
+// already used or meant for another purpose.
+//
+// Returns:
+//   - int: The ID of the user the token was issued for.
+//   - string: The data stored with the token.
+//   - error: An error if the token can't be used.
+func (r *AuthRepo) consumeUserToken(ctx context.Context, tokenString string, purpose string) (int, string, error) {
+	token, err := r.verifyUserToken(tokenString, purpose)
+	if err != nil {
+		return 0, "", err
+	}
+
+	tokenHash := hashToken(tokenString)
+	res, err := r.db.ExecContext(ctx, USE_USER_TOKEN, tokenHash, purpose, time.Now().Unix())
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on using user token", "function", "consumeUserToken", "purpose", purpose, "error", err)
+		return 0, "", err
+	}
+	if rows, err := res.RowsAffected(); err != nil || rows == 0 {
+		return 0, "", errInvalidUserToken
+	}
+
+	var userID int
+	var data string
+	err = r.db.QueryRowContext(ctx, FETCH_USER_TOKEN, tokenHash, purpose).Scan(&userID, &data)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on fetching user token", "function", "consumeUserToken", "purpose", purpose, "error", err)
+		return 0, "", err
+	}
+	if token.Subject() != strconv.Itoa(userID) {
+		return 0, "", errInvalidUserToken
+	}
+	return userID, data, nil
+}
+
+// restoreUserToken makes a token used up by consumeUserToken usable again, for actions which fail
+// after the token was consumed and shouldn't cost the user their link.
+func (r *AuthRepo) restoreUserToken(ctx context.Context, tokenString string, purpose string) error {
+	_, err := r.db.ExecContext(ctx, RESTORE_USER_TOKEN, hashToken(tokenString), purpose)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on restoring user token", "function", "restoreUserToken", "purpose", purpose, "error", err)
+	}
+	return err
+}
+
+// peekUserToken is like consumeUserToken, but leaves the token usable. It lets an action check its
+// input before the token is used up, so a rejected input doesn't cost the user their link.
+func (r *AuthRepo) peekUserToken(ctx context.Context, tokenString string, purpose string) (int, string, error) {
+	token, err := r.verifyUserToken(tokenString, purpose)
+	if err != nil {
+		return 0, "", err
+	}
+
+	var userID int
+	var data string
+	err = r.db.QueryRowContext(ctx, FETCH_USABLE_USER_TOKEN, hashToken(tokenString), purpose, time.Now().Unix()).Scan(&userID, &data)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, "", errInvalidUserToken
+		}
+		utils.Log.ErrorContext(ctx, "error on fetching user token", "function", "peekUserToken", "purpose", purpose, "error", err)
+		return 0, "", err
+	}
+	if token.Subject() != strconv.Itoa(userID) {
+		return 0, "", errInvalidUserToken
+	}
+	return userID, data, nil
+}
+
+// verifyUserToken verifies the signature and the claims of a token created by issueUserToken for the given purpose.
+func (r *AuthRepo) verifyUserToken(tokenString string, purpose string) (jwt.Token, error) {
+	token, err := r.auth.Verify(tokenString)
+	if err == nil {
+		err = config.ValidateIssuerAndAudience(token)
+	}
+	if err == nil {
+		err = config.ValidateTokenType(token, purpose)
+	}
+	if err != nil {
+		return nil, errInvalidUserToken
+	}
+	return token, nil
+}
+
+// latestUserToken returns the newest usable token of a user for the given purpose, for actions which
+// identify the token by its data rather than by the token itself, e.g. a code typed in from an email.
+// It returns errInvalidUserToken if the user has no usable token.
+//
+// Returns:
+//   - string: The hash of the token, which marks it as used with USE_USER_TOKEN.
+//   - string: The data stored with the token.
+//   - error: An error if there is no usable token.
+func (r *AuthRepo) latestUserToken(ctx context.Context, userID int, purpose string) (string, string, error) {
+	var tokenHash, data string
+	err := r.db.QueryRowContext(ctx, FETCH_LATEST_USER_TOKEN, userID, purpose, time.Now().Unix()).Scan(&tokenHash, &data)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", "", errInvalidUserToken
+		}
+		utils.Log.ErrorContext(ctx, "error on fetching user token", "function", "latestUserToken", "purpose", purpose, "error", err)
+		return "", "", err
+	}
+	return tokenHash, data, nil
+}
+
+// countRecentUserTokens returns how many tokens for the given purpose were issued to a user since the given time.
+// It is used to limit how often emails carrying such tokens are sent.
+func (r *AuthRepo) countRecentUserTokens(ctx context.Context, userID int, purpose string, since time.Time) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, COUNT_RECENT_USER_TOKENS, userID, purpose, since).Scan(&count)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on counting user tokens", "function", "countRecentUserTokens", "purpose", purpose, "error", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// invalidateUserTokens marks every unused token of a user for the given purpose as used,
+// e.g. the other reset links once the password was reset with one of them.
+func (r *AuthRepo) invalidateUserTokens(ctx context.Context, userID int, purpose string) error {
+	_, err := r.db.ExecContext(ctx, INVALIDATE_USER_TOKENS, userID, purpose)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on invalidating user tokens", "function", "invalidateUserTokens", "purpose", purpose, "error", err)
+	}
+	return err
+}
+
+// inBackground runs the work of a request which has to answer the same whether or not an account exists,
+// e.g. looking up the account of an email address and emailing it a token. The response doesn't wait for it,
+// so neither its duration nor its errors reveal the account, which is why fn only logs errors. The work keeps
+// the values of the request context, but not its cancellation.
+func inBackground(ctx context.Context, fn func(ctx context.Context)) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), backgroundTimeout)
+	go func() {
+		defer cancel()
+		fn(ctx)
+	}()
+}
@@ -0,0 +1,358 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/config"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/models"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/utils"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/webauthn"
+)
+
+const (
+	INSERT_WEBAUTHN_CHALLENGE  = `INSERT INTO webauthn_challenges (challenge_hash, user_id, ceremony, expire_time) VALUES (?, ?, ?, ?)`
+	FETCH_WEBAUTHN_CHALLENGE   = `SELECT user_id FROM webauthn_challenges WHERE challenge_hash = ? AND ceremony = ? AND expire_time > ?`
+	DELETE_WEBAUTHN_CHALLENGE  = `DELETE FROM webauthn_challenges WHERE challenge_hash = ?`
+	PURGE_WEBAUTHN_CHALLENGES  = `DELETE FROM webauthn_challenges WHERE expire_time <= ?`
+	INSERT_WEBAUTHN_CREDENTIAL = `
+		INSERT INTO webauthn_credentials (user_id, credential_id, public_key, sign_count, transports, name)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+	FETCH_WEBAUTHN_CREDENTIAL       = `SELECT id, user_id, public_key, sign_count FROM webauthn_credentials WHERE credential_id = ?`
+	FETCH_USER_WEBAUTHN_CREDENTIALS = `SELECT id, name, created_at, last_used_at FROM webauthn_credentials WHERE user_id = ? ORDER BY id`
+	FETCH_USER_WEBAUTHN_DESCRIPTORS = `SELECT credential_id, transports FROM webauthn_credentials WHERE user_id = ?`
+	UPDATE_WEBAUTHN_SIGN_COUNT      = `UPDATE webauthn_credentials SET sign_count = ?, last_used_at = CURRENT_TIMESTAMP WHERE id = ? AND sign_count = ?`
+	DELETE_USER_WEBAUTHN_CREDENTIAL = `DELETE FROM webauthn_credentials WHERE id = ? AND user_id = ?`
+	webauthnRegistrationCeremony    = "registration"
+	webauthnAuthenticationCeremony  = "authentication"
+)
+
+// BeginWebAuthnRegistration starts the registration of a passkey for a logged in user. It stores a new
+// challenge and returns the options for navigator.credentials.create(). Passkeys the user already
+// registered are excluded, so an authenticator can't register twice.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - userID: The ID of the user.
+//
+// Returns:
+//   - *webauthn.CreationOptions: The options of the registration ceremony.
+//   - int: The HTTP status code indicating the result of the operation.
+//   - error: An error message if the operation fails.
+func (r *AuthRepo) BeginWebAuthnRegistration(ctx context.Context, userID int) (*webauthn.CreationOptions, int, error) {
+	var email string
+	if err := r.db.QueryRowContext(ctx, FETCH_USER_EMAIL, userID).Scan(&email); err != nil {
+		utils.Log.ErrorContext(ctx, "error on fetching user", "function", "BeginWebAuthnRegistration", "error", err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	exclude, err := r.fetchCredentialDescriptors(ctx, userID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	challenge, err := r.newWebAuthnChallenge(ctx, userID, webauthnRegistrationCeremony)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+
+	user := webauthn.UserEntity{ID: webauthnUserHandle(userID), Name: email, DisplayName: email}
+	return r.relyingParty.CreationOptions(user, challenge, exclude), http.StatusOK, nil
+}
+
+// FinishWebAuthnRegistration verifies the passkey created by the authenticator and stores it for the user.
+// The challenge of the ceremony can only be used once and only by the user it was created for.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - userID: The ID of the user.
+//   - name: A name for the passkey chosen by the user, e.g. the device.
+//   - credential: The response of navigator.credentials.create().
+//
+// Returns:
+//   - int: The HTTP status code indicating the result of the operation.
+//   - error: An error message if the operation fails.
+func (r *AuthRepo) FinishWebAuthnRegistration(ctx context.Context, userID int, name string, credential *webauthn.CredentialCreationResponse) (int, error) {
+	challenge, challengeUserID, err := r.consumeWebAuthnChallenge(ctx, credential.Response.ClientDataJSON, webauthnRegistrationCeremony)
+	if err != nil || challengeUserID != userID {
+		if err == nil || err == errInvalidUserToken {
+			return http.StatusBadRequest, fmt.Errorf("invalid or expired registration, please try again")
+		}
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+
+	newCredential, err := r.relyingParty.VerifyRegistration(credential, challenge)
+	if err != nil {
+		utils.Log.WarnContext(ctx, "passkey registration rejected", "function", "FinishWebAuthnRegistration", "userID", userID, "error", err)
+		return http.StatusBadRequest, fmt.Errorf("the passkey couldn't be verified, please try again")
+	}
+
+	_, err = r.db.ExecContext(ctx, INSERT_WEBAUTHN_CREDENTIAL, userID, newCredential.ID, newCredential.PublicKey, newCredential.SignCount, strings.Join(newCredential.Transports, ","), name)
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+			return http.StatusConflict, fmt.Errorf("this passkey is already registered")
+		}
+		utils.Log.ErrorContext(ctx, "error on saving passkey", "function", "FinishWebAuthnRegistration", "error", err)
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	r.recordSecurityEvent(ctx, userID, "", SECURITY_EVENT_PASSKEY_REGISTERED, fmt.Sprintf("passkey %q registered", name))
+	return http.StatusOK, nil
+}
+
+// BeginWebAuthnLogin starts a login with a passkey. It stores a new challenge and returns the options for
+// navigator.credentials.get(). Without an email address any passkey of the site can be chosen, with one the
+// passkeys of that account are listed. Unknown addresses get the same options as accounts without passkeys.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - email: The email address of the account, may be empty.
+//
+// Returns:
+//   - *webauthn.RequestOptions: The options of the authentication ceremony.
+//   - int: The HTTP status code indicating the result of the operation.
+//   - error: An error message if the operation fails.
+func (r *AuthRepo) BeginWebAuthnLogin(ctx context.Context, email string) (*webauthn.RequestOptions, int, error) {
+	allow := []webauthn.CredentialDescriptor{}
+	userID := 0
+	if email != "" {
+		err := r.db.QueryRowContext(ctx, FETCH_USER_ID_BY_EMAIL, email).Scan(&userID)
+		if err != nil && err != sql.ErrNoRows {
+			utils.Log.ErrorContext(ctx, "error on fetching user", "function", "BeginWebAuthnLogin", "error", err)
+			return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+		}
+	}
+	if userID != 0 {
+		var err error
+		if allow, err = r.fetchCredentialDescriptors(ctx, userID); err != nil {
+			return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+		}
+	}
+
+	challenge, err := r.newWebAuthnChallenge(ctx, userID, webauthnAuthenticationCeremony)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	return r.relyingParty.RequestOptions(challenge, allow), http.StatusOK, nil
+}
+
+// FinishWebAuthnLogin verifies the assertion of a passkey and starts a new session for its owner, just like
+// LoginUser. Passkeys require user verification, so they count as both factors and no two-factor code is asked.
+// An assertion whose signature counter didn't increase means the passkey was probably cloned: the login is
+// refused and a security event is recorded.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - credential: The response of navigator.credentials.get().
+//
+// Returns:
+//   - *models.TokenResponse: The authentication tokens of the new session.
+//   - int: The HTTP status code indicating the result of the operation.
+//   - error: An error message if the operation fails.
+func (r *AuthRepo) FinishWebAuthnLogin(ctx context.Context, credential *webauthn.CredentialAssertionResponse) (*models.TokenResponse, int, error) {
+	challenge, challengeUserID, err := r.consumeWebAuthnChallenge(ctx, credential.Response.ClientDataJSON, webauthnAuthenticationCeremony)
+	if err != nil {
+		if err == errInvalidUserToken {
+			return nil, http.StatusUnauthorized, fmt.Errorf("invalid or expired login, please try again")
+		}
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+
+	var id, userID int
+	var signCount uint32
+	stored := &webauthn.Credential{ID: credential.RawID}
+	err = r.db.QueryRowContext(ctx, FETCH_WEBAUTHN_CREDENTIAL, []byte(credential.RawID)).Scan(&id, &userID, &stored.PublicKey, &signCount)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, http.StatusUnauthorized, fmt.Errorf("unknown passkey")
+		}
+		utils.Log.ErrorContext(ctx, "error on fetching passkey", "function", "FinishWebAuthnLogin", "error", err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	stored.SignCount = signCount
+	userHandle := credential.Response.UserHandle
+	if (challengeUserID != 0 && challengeUserID != userID) || (len(userHandle) != 0 && string(userHandle) != string(webauthnUserHandle(userID))) {
+		return nil, http.StatusUnauthorized, fmt.Errorf("invalid passkey")
+	}
+
+	newSignCount, err := r.relyingParty.VerifyAssertion(credential, challenge, stored)
+	if err != nil {
+		if err == webauthn.ErrSignCount {
+			utils.Log.WarnContext(ctx, "passkey signature counter did not increase", "function", "FinishWebAuthnLogin", "userID", userID, "credential", id)
+			r.recordSecurityEvent(ctx, userID, "", SECURITY_EVENT_PASSKEY_CLONED, fmt.Sprintf("signature counter of passkey %d did not increase, login refused", id))
+		}
+		return nil, http.StatusUnauthorized, fmt.Errorf("invalid passkey")
+	}
+
+	// The stored counter is part of the WHERE clause, so of two logins racing with the same counter only one succeeds.
+	res, err := r.db.ExecContext(ctx, UPDATE_WEBAUTHN_SIGN_COUNT, newSignCount, id, signCount)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on updating passkey", "function", "FinishWebAuthnLogin", "error", err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	if rows, err := res.RowsAffected(); err != nil || (rows == 0 && newSignCount != 0) {
+		return nil, http.StatusUnauthorized, fmt.Errorf("invalid passkey")
+	}
+
+	sessionID, err := newSessionID()
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on generating session id", "function", "FinishWebAuthnLogin", "error", err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	return r.getAuthTokens(ctx, userID, sessionID)
+}
+
+// GetWebAuthnCredentials lists the passkeys of a user.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - userID: The ID of the user.
+//
+// Returns:
+//   - []*models.WebAuthnCredential: The passkeys of the user.
+//   - int: The HTTP status code indicating the result of the operation.
+//   - error: An error message if the operation fails.
+func (r *AuthRepo) GetWebAuthnCredentials(ctx context.Context, userID int) ([]*models.WebAuthnCredential, int, error) {
+	rows, err := r.db.QueryContext(ctx, FETCH_USER_WEBAUTHN_CREDENTIALS, userID)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on fetching passkeys", "function", "GetWebAuthnCredentials", "error", err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	defer rows.Close()
+
+	credentials := []*models.WebAuthnCredential{}
+	for rows.Next() {
+		credential := &models.WebAuthnCredential{}
+		if err := rows.Scan(&credential.ID, &credential.Name, &credential.CreatedAt, &credential.LastUsedAt); err != nil {
+			utils.Log.ErrorContext(ctx, "error on fetching passkeys", "function", "GetWebAuthnCredentials", "error", err)
+			return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+		}
+		credentials = append(credentials, credential)
+	}
+	if err := rows.Err(); err != nil {
+		utils.Log.ErrorContext(ctx, "error on fetching passkeys", "function", "GetWebAuthnCredentials", "error", err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	return credentials, http.StatusOK, nil
+}
+
+// DeleteWebAuthnCredential removes a passkey of a user.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - userID: The ID of the user.
+//   - credentialID: The ID of the passkey, as listed by GetWebAuthnCredentials.
+//
+// Returns:
+//   - int: The HTTP status code indicating the result of the operation.
+//   - error: An error message if the operation fails.
+func (r *AuthRepo) DeleteWebAuthnCredential(ctx context.Context, userID int, credentialID int) (int, error) {
+	res, err := r.db.ExecContext(ctx, DELETE_USER_WEBAUTHN_CREDENTIAL, credentialID, userID)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on deleting passkey", "function", "DeleteWebAuthnCredential", "error", err)
+		return http.StatusInternalServerError, fmt.Errorf("please try again later")
+	}
+	if rows, err := res.RowsAffected(); err != nil || rows == 0 {
+		return http.StatusNotFound, fmt.Errorf("passkey not found")
+	}
+	r.recordSecurityEvent(ctx, userID, "", SECURITY_EVENT_PASSKEY_REMOVED, fmt.Sprintf("passkey %d removed", credentialID))
+	return http.StatusOK, nil
+}
+
+// newWebAuthnChallenge creates and stores the challenge of a new ceremony, valid for WEBAUTHN_CHALLENGE_EXPIRE
+// minutes. Only its hash is stored, along with the user for registrations and logins with an email address.
+// Expired challenges are purged on the way.
+func (r *AuthRepo) newWebAuthnChallenge(ctx context.Context, userID int, ceremony string) ([]byte, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on generating challenge", "function", "newWebAuthnChallenge", "error", err)
+		return nil, err
+	}
+	now := time.Now()
+	if _, err := r.db.ExecContext(ctx, PURGE_WEBAUTHN_CHALLENGES, now.Unix()); err != nil {
+		utils.Log.ErrorContext(ctx, "error on purging challenges", "function", "newWebAuthnChallenge", "error", err)
+	}
+
+	var challengeUserID sql.NullInt64
+	if userID != 0 {
+		challengeUserID = sql.NullInt64{Int64: int64(userID), Valid: true}
+	}
+	expireTime := now.Add(time.Duration(config.Envs.WEBAUTHN_CHALLENGE_EXPIRE) * time.Minute).Unix()
+	_, err = r.db.ExecContext(ctx, INSERT_WEBAUTHN_CHALLENGE, hashToken(string(challenge)), challengeUserID, ceremony, expireTime)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on saving challenge", "function", "newWebAuthnChallenge", "error", err)
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// consumeWebAuthnChallenge looks up the challenge a ceremony response was signed over and deletes it, so
+// every challenge is used once. It returns errInvalidUserToken for unknown or expired challenges.
+//
+// Returns:
+//   - []byte: The challenge.
+//   - int: The ID of the user the challenge was created for, 0 if it wasn't created for a user.
+//   - error: An error if the challenge can't be used.
+func (r *AuthRepo) consumeWebAuthnChallenge(ctx context.Context, clientDataJSON []byte, ceremony string) ([]byte, int, error) {
+	clientData, err := webauthn.ParseClientData(clientDataJSON)
+	if err != nil {
+		return nil, 0, errInvalidUserToken
+	}
+	challengeHash := hashToken(string(clientData.Challenge))
+
+	var userID sql.NullInt64
+	err = r.db.QueryRowContext(ctx, FETCH_WEBAUTHN_CHALLENGE, challengeHash, ceremony, time.Now().Unix()).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, 0, errInvalidUserToken
+		}
+		utils.Log.ErrorContext(ctx, "error on fetching challenge", "function", "consumeWebAuthnChallenge", "error", err)
+		return nil, 0, err
+	}
+	res, err := r.db.ExecContext(ctx, DELETE_WEBAUTHN_CHALLENGE, challengeHash)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on deleting challenge", "function", "consumeWebAuthnChallenge", "error", err)
+		return nil, 0, err
+	}
+	if rows, err := res.RowsAffected(); err != nil || rows == 0 {
+		return nil, 0, errInvalidUserToken
+	}
+	return clientData.Challenge, int(userID.Int64), nil
+}
+
+// fetchCredentialDescriptors returns the IDs and transports of the passkeys of a user.
+func (r *AuthRepo) fetchCredentialDescriptors(ctx context.Context, userID int) ([]webauthn.CredentialDescriptor, error) {
+	rows, err := r.db.QueryContext(ctx, FETCH_USER_WEBAUTHN_DESCRIPTORS, userID)
+	if err != nil {
+		utils.Log.ErrorContext(ctx, "error on fetching passkeys", "function", "fetchCredentialDescriptors", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	descriptors := []webauthn.CredentialDescriptor{}
+	for rows.Next() {
+		var id []byte
+		var transports string
+		if err := rows.Scan(&id, &transports); err != nil {
+			utils.Log.ErrorContext(ctx, "error on fetching passkeys", "function", "fetchCredentialDescriptors", "error", err)
+			return nil, err
+		}
+		descriptor := webauthn.CredentialDescriptor{Type: "public-key", ID: id}
+		if transports != "" {
+			descriptor.Transports = strings.Split(transports, ",")
+		}
+		descriptors = append(descriptors, descriptor)
+	}
+	return descriptors, rows.Err()
+}
+
+// webauthnUserHandle is the user handle of a user's passkeys, an opaque ID without personal data.
+func webauthnUserHandle(userID int) []byte {
+	return []byte(strconv.Itoa(userID))
+}
@@ -0,0 +1,49 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/config"
+)
+
+// Encrypt seals a secret with AES-256-GCM and MFA_ENCRYPTION_KEY for storage in the database.
+// The result is the base64 encoded nonce followed by the ciphertext.
+func Encrypt(plaintext []byte) (string, error) {
+	aead, err := newAEAD()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+// Decrypt opens a secret sealed by Encrypt.
+func Decrypt(ciphertext string) ([]byte, error) {
+	aead, err := newAEAD()
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("invalid encrypted secret")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+}
+
+func newAEAD() (cipher.AEAD, error) {
+	if len(config.Envs.MFA_ENCRYPTION_KEY) != 32 {
+		return nil, fmt.Errorf("MFA_ENCRYPTION_KEY is not set")
+	}
+	block, err := aes.NewCipher(config.Envs.MFA_ENCRYPTION_KEY)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -2,9 +2,15 @@ package service
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
 
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/config"
 	"github.com/the-arcade-01/golang-jwt-authentication/internal/models"
 	"github.com/the-arcade-01/golang-jwt-authentication/internal/repository"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/validator"
 )
 
 type AuthService struct {
@@ -18,7 +24,13 @@ func NewAuthService() AuthServiceInterface {
 }
 
 func (svc *AuthService) CreateUser(ctx context.Context, body *models.AuthReqBody) (*models.Response, *models.ErrorResponse) {
-	user := &models.User{Email: body.Email, Password: body.Password}
+	user := &models.User{Email: validator.NormalizeEmail(body.Email), Password: body.Password}
+	v := validator.New()
+	v.Email("email", user.Email)
+	v.Password("password", user.Password, user.Email)
+	if err := v.Err(); err != nil {
+		return nil, models.NewErrorResponse(http.StatusBadRequest, err)
+	}
 	status, err := svc.repo.CreateUser(ctx, user)
 	if err != nil {
 		return nil, models.NewErrorResponse(status, err)
@@ -26,16 +38,33 @@ func (svc *AuthService) CreateUser(ctx context.Context, body *models.AuthReqBody
 	return &models.Response{Success: true, Status: status}, nil
 }
 
-func (svc *AuthService) LogoutUser(ctx context.Context, userID int) (*models.Response, *models.ErrorResponse) {
-	status, err := svc.repo.LogoutUser(ctx, userID)
+func (svc *AuthService) LogoutUser(ctx context.Context, userID int, sessionID string, accessTokenID string, accessTokenExpire int64) (*models.Response, *models.ErrorResponse) {
+	status, err := svc.repo.LogoutUser(ctx, userID, sessionID, accessTokenID, accessTokenExpire)
+	if err != nil {
+		return nil, models.NewErrorResponse(status, err)
+	}
+	return &models.Response{Success: true, Status: status}, nil
+}
+
+// RevokeAccessToken revokes an access token by its jti. Without an expiration time the token is
+// denied for the longest time an access token can live.
+func (svc *AuthService) RevokeAccessToken(ctx context.Context, body *models.RevokeAccessTokenReqBody) (*models.Response, *models.ErrorResponse) {
+	if body.TokenID == "" {
+		return nil, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide valid input"))
+	}
+	expireTime := body.ExpireTime
+	if expireTime == 0 {
+		expireTime = time.Now().Add(time.Duration(config.Envs.HTTP_ACCESS_TOKEN_EXPIRE) * time.Minute).Unix()
+	}
+	status, err := svc.repo.RevokeAccessToken(ctx, body.TokenID, expireTime)
 	if err != nil {
 		return nil, models.NewErrorResponse(status, err)
 	}
 	return &models.Response{Success: true, Status: status}, nil
 }
 
-func (svc *AuthService) DeleteUser(ctx context.Context, userID int) (*models.Response, *models.ErrorResponse) {
-	status, err := svc.repo.DeleteUser(ctx, userID)
+func (svc *AuthService) DeleteUser(ctx context.Context, userID int, accessTokenID string, accessTokenExpire int64) (*models.Response, *models.ErrorResponse) {
+	status, err := svc.repo.DeleteUser(ctx, userID, accessTokenID, accessTokenExpire)
 	if err != nil {
 		return nil, models.NewErrorResponse(status, err)
 	}
@@ -51,7 +80,7 @@ func (svc *AuthService) GetUserByID(ctx context.Context, userID int) (*models.Re
 }
 
 func (svc *AuthService) LoginUser(ctx context.Context, body *models.AuthReqBody) (*models.TokenResponse, *models.ErrorResponse) {
-	user := &models.User{Email: body.Email, Password: body.Password}
+	user := &models.User{Email: validator.NormalizeEmail(body.Email), Password: body.Password}
 	tokenRes, status, err := svc.repo.LoginUser(ctx, user)
 	if err != nil {
 		return nil, models.NewErrorResponse(status, err)
@@ -59,8 +88,304 @@ func (svc *AuthService) LoginUser(ctx context.Context, body *models.AuthReqBody)
 	return tokenRes, nil
 }
 
-func (svc *AuthService) GenerateTokens(ctx context.Context, userID int, oldRefreshToken string) (*models.TokenResponse, *models.ErrorResponse) {
-	tokenRes, status, err := svc.repo.GenerateTokens(ctx, userID, oldRefreshToken)
+func (svc *AuthService) GenerateTokens(ctx context.Context, oldRefreshToken string) (*models.TokenResponse, *models.ErrorResponse) {
+	tokenRes, status, err := svc.repo.GenerateTokens(ctx, oldRefreshToken)
+	if err != nil {
+		return nil, models.NewErrorResponse(status, err)
+	}
+	return tokenRes, nil
+}
+
+func (svc *AuthService) IntrospectToken(ctx context.Context, token string, tokenTypeHint string) (*models.IntrospectionResponse, *models.ErrorResponse) {
+	if token == "" {
+		return nil, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide a token"))
+	}
+	res, status, err := svc.repo.IntrospectToken(ctx, token, tokenTypeHint)
+	if err != nil {
+		return nil, models.NewErrorResponse(status, err)
+	}
+	return res, nil
+}
+
+func (svc *AuthService) RevokeToken(ctx context.Context, token string, tokenTypeHint string) (*models.Response, *models.ErrorResponse) {
+	if token == "" {
+		return nil, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide a token"))
+	}
+	status, err := svc.repo.RevokeToken(ctx, token, tokenTypeHint)
+	if err != nil {
+		return nil, models.NewErrorResponse(status, err)
+	}
+	return &models.Response{Success: true, Status: status}, nil
+}
+
+func (svc *AuthService) VerifyEmail(ctx context.Context, body *models.TokenReqBody) (*models.Response, *models.ErrorResponse) {
+	if body.Token == "" {
+		return nil, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide a token"))
+	}
+	status, err := svc.repo.VerifyEmail(ctx, body.Token)
+	if err != nil {
+		return nil, models.NewErrorResponse(status, err)
+	}
+	return &models.Response{Success: true, Status: status}, nil
+}
+
+func (svc *AuthService) ResendVerificationEmail(ctx context.Context, body *models.EmailReqBody) (*models.Response, *models.ErrorResponse) {
+	if body.Email == "" {
+		return nil, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide an email"))
+	}
+	status, err := svc.repo.ResendVerificationEmail(ctx, validator.NormalizeEmail(body.Email))
+	if err != nil {
+		return nil, models.NewErrorResponse(status, err)
+	}
+	return &models.Response{Success: true, Status: status}, nil
+}
+
+func (svc *AuthService) ForgotPassword(ctx context.Context, body *models.EmailReqBody) (*models.Response, *models.ErrorResponse) {
+	if body.Email == "" {
+		return nil, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide an email"))
+	}
+	status, err := svc.repo.ForgotPassword(ctx, validator.NormalizeEmail(body.Email))
+	if err != nil {
+		return nil, models.NewErrorResponse(status, err)
+	}
+	return &models.Response{Success: true, Status: status}, nil
+}
+
+func (svc *AuthService) ResetPassword(ctx context.Context, body *models.ResetPasswordReqBody) (*models.Response, *models.ErrorResponse) {
+	if body.Token == "" || body.Password == "" {
+		return nil, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide a token and a new password"))
+	}
+	status, err := svc.repo.ResetPassword(ctx, body.Token, body.Password)
+	if err != nil {
+		return nil, models.NewErrorResponse(status, err)
+	}
+	return &models.Response{Success: true, Status: status}, nil
+}
+
+func (svc *AuthService) ChangePassword(ctx context.Context, userID int, sessionID string, body *models.ChangePasswordReqBody) (*models.Response, *models.ErrorResponse) {
+	if body.CurrentPassword == "" || body.NewPassword == "" {
+		return nil, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide the current and the new password"))
+	}
+	if body.CurrentPassword == body.NewPassword {
+		return nil, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("the new password must be different from the current one"))
+	}
+	status, err := svc.repo.ChangePassword(ctx, userID, sessionID, body.CurrentPassword, body.NewPassword, body.SignOutOtherSessions)
+	if err != nil {
+		return nil, models.NewErrorResponse(status, err)
+	}
+	return &models.Response{Success: true, Status: status}, nil
+}
+
+func (svc *AuthService) RequestEmailChange(ctx context.Context, userID int, body *models.ChangeEmailReqBody) (*models.Response, *models.ErrorResponse) {
+	newEmail := validator.NormalizeEmail(body.NewEmail)
+	v := validator.New()
+	v.Required("password", body.Password)
+	v.Email("new_email", newEmail)
+	if err := v.Err(); err != nil {
+		return nil, models.NewErrorResponse(http.StatusBadRequest, err)
+	}
+	status, err := svc.repo.RequestEmailChange(ctx, userID, body.Password, newEmail)
+	if err != nil {
+		return nil, models.NewErrorResponse(status, err)
+	}
+	return &models.Response{Success: true, Status: status, Data: "please confirm the change with the link sent to the new email"}, nil
+}
+
+func (svc *AuthService) ConfirmEmailChange(ctx context.Context, body *models.TokenReqBody) (*models.Response, *models.ErrorResponse) {
+	if body.Token == "" {
+		return nil, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide a token"))
+	}
+	status, err := svc.repo.ConfirmEmailChange(ctx, body.Token)
+	if err != nil {
+		return nil, models.NewErrorResponse(status, err)
+	}
+	return &models.Response{Success: true, Status: status}, nil
+}
+
+func (svc *AuthService) CancelEmailChange(ctx context.Context, body *models.TokenReqBody) (*models.Response, *models.ErrorResponse) {
+	if body.Token == "" {
+		return nil, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide a token"))
+	}
+	status, err := svc.repo.CancelEmailChange(ctx, body.Token)
+	if err != nil {
+		return nil, models.NewErrorResponse(status, err)
+	}
+	return &models.Response{Success: true, Status: status}, nil
+}
+
+func (svc *AuthService) UnlockAccount(ctx context.Context, body *models.TokenReqBody) (*models.Response, *models.ErrorResponse) {
+	if body.Token == "" {
+		return nil, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide a token"))
+	}
+	status, err := svc.repo.UnlockAccount(ctx, body.Token)
+	if err != nil {
+		return nil, models.NewErrorResponse(status, err)
+	}
+	return &models.Response{Success: true, Status: status}, nil
+}
+
+func (svc *AuthService) UnlockUser(ctx context.Context, userID int) (*models.Response, *models.ErrorResponse) {
+	status, err := svc.repo.UnlockUser(ctx, userID)
+	if err != nil {
+		return nil, models.NewErrorResponse(status, err)
+	}
+	return &models.Response{Success: true, Status: status}, nil
+}
+
+func (svc *AuthService) EnrollTOTP(ctx context.Context, userID int) (*models.Response, *models.ErrorResponse) {
+	res, status, err := svc.repo.EnrollTOTP(ctx, userID)
+	if err != nil {
+		return nil, models.NewErrorResponse(status, err)
+	}
+	return &models.Response{Success: true, Status: status, Data: res}, nil
+}
+
+func (svc *AuthService) ConfirmTOTP(ctx context.Context, userID int, body *models.MFACodeReqBody) (*models.Response, *models.ErrorResponse) {
+	if body.Code == "" {
+		return nil, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide a code"))
+	}
+	res, status, err := svc.repo.ConfirmTOTP(ctx, userID, body.Code)
+	if err != nil {
+		return nil, models.NewErrorResponse(status, err)
+	}
+	return &models.Response{Success: true, Status: status, Data: res}, nil
+}
+
+func (svc *AuthService) DisableTOTP(ctx context.Context, userID int, body *models.DisableMFAReqBody) (*models.Response, *models.ErrorResponse) {
+	if body.Password == "" {
+		return nil, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide your password"))
+	}
+	status, err := svc.repo.DisableTOTP(ctx, userID, body.Password, body.Code)
+	if err != nil {
+		return nil, models.NewErrorResponse(status, err)
+	}
+	return &models.Response{Success: true, Status: status}, nil
+}
+
+func (svc *AuthService) RegenerateRecoveryCodes(ctx context.Context, userID int, body *models.MFACodeReqBody) (*models.Response, *models.ErrorResponse) {
+	if body.Code == "" {
+		return nil, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide a code"))
+	}
+	res, status, err := svc.repo.RegenerateRecoveryCodes(ctx, userID, body.Code)
+	if err != nil {
+		return nil, models.NewErrorResponse(status, err)
+	}
+	return &models.Response{Success: true, Status: status, Data: res}, nil
+}
+
+func (svc *AuthService) LoginMFA(ctx context.Context, body *models.MFALoginReqBody) (*models.TokenResponse, *models.ErrorResponse) {
+	if body.MFAToken == "" || body.Code == "" {
+		return nil, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide the mfa token and a code"))
+	}
+	tokenRes, status, err := svc.repo.LoginMFA(ctx, body.MFAToken, body.Code)
+	if err != nil {
+		return nil, models.NewErrorResponse(status, err)
+	}
+	return tokenRes, nil
+}
+
+func (svc *AuthService) BeginWebAuthnRegistration(ctx context.Context, userID int) (*models.Response, *models.ErrorResponse) {
+	options, status, err := svc.repo.BeginWebAuthnRegistration(ctx, userID)
+	if err != nil {
+		return nil, models.NewErrorResponse(status, err)
+	}
+	return &models.Response{Success: true, Status: status, Data: options}, nil
+}
+
+func (svc *AuthService) FinishWebAuthnRegistration(ctx context.Context, userID int, body *models.WebAuthnRegisterReqBody) (*models.Response, *models.ErrorResponse) {
+	name := strings.TrimSpace(body.Name)
+	if name == "" {
+		name = "Passkey"
+	}
+	if len(name) > 64 {
+		return nil, models.NewErrorResponse(http.StatusBadRequest, models.FieldErrors{{Field: "name", Message: "must be at most 64 characters long"}})
+	}
+	status, err := svc.repo.FinishWebAuthnRegistration(ctx, userID, name, &body.Credential)
+	if err != nil {
+		return nil, models.NewErrorResponse(status, err)
+	}
+	return &models.Response{Success: true, Status: status}, nil
+}
+
+func (svc *AuthService) BeginWebAuthnLogin(ctx context.Context, body *models.EmailReqBody) (*models.Response, *models.ErrorResponse) {
+	options, status, err := svc.repo.BeginWebAuthnLogin(ctx, validator.NormalizeEmail(body.Email))
+	if err != nil {
+		return nil, models.NewErrorResponse(status, err)
+	}
+	return &models.Response{Success: true, Status: status, Data: options}, nil
+}
+
+func (svc *AuthService) FinishWebAuthnLogin(ctx context.Context, body *models.WebAuthnLoginReqBody) (*models.TokenResponse, *models.ErrorResponse) {
+	if len(body.Credential.RawID) == 0 {
+		return nil, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide a credential"))
+	}
+	tokenRes, status, err := svc.repo.FinishWebAuthnLogin(ctx, &body.Credential)
+	if err != nil {
+		return nil, models.NewErrorResponse(status, err)
+	}
+	return tokenRes, nil
+}
+
+func (svc *AuthService) GetWebAuthnCredentials(ctx context.Context, userID int) (*models.Response, *models.ErrorResponse) {
+	credentials, status, err := svc.repo.GetWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, models.NewErrorResponse(status, err)
+	}
+	return &models.Response{Success: true, Status: status, Data: credentials}, nil
+}
+
+func (svc *AuthService) DeleteWebAuthnCredential(ctx context.Context, userID int, credentialID int) (*models.Response, *models.ErrorResponse) {
+	status, err := svc.repo.DeleteWebAuthnCredential(ctx, userID, credentialID)
+	if err != nil {
+		return nil, models.NewErrorResponse(status, err)
+	}
+	return &models.Response{Success: true, Status: status}, nil
+}
+
+func (svc *AuthService) RequestMagicLink(ctx context.Context, body *models.EmailReqBody) (*models.MagicLinkResponse, *models.ErrorResponse) {
+	email := validator.NormalizeEmail(body.Email)
+	v := validator.New()
+	v.Email("email", email)
+	if err := v.Err(); err != nil {
+		return nil, models.NewErrorResponse(http.StatusBadRequest, err)
+	}
+	res, status, err := svc.repo.RequestMagicLink(ctx, email)
+	if err != nil {
+		return nil, models.NewErrorResponse(status, err)
+	}
+	return res, nil
+}
+
+func (svc *AuthService) VerifyMagicLink(ctx context.Context, body *models.TokenReqBody, nonce string) (*models.TokenResponse, *models.ErrorResponse) {
+	if body.Token == "" {
+		return nil, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide a token"))
+	}
+	tokenRes, status, err := svc.repo.VerifyMagicLink(ctx, body.Token, nonce)
+	if err != nil {
+		return nil, models.NewErrorResponse(status, err)
+	}
+	return tokenRes, nil
+}
+
+func (svc *AuthService) RequestEmailOTP(ctx context.Context, body *models.EmailReqBody) (*models.Response, *models.ErrorResponse) {
+	email := validator.NormalizeEmail(body.Email)
+	v := validator.New()
+	v.Email("email", email)
+	if err := v.Err(); err != nil {
+		return nil, models.NewErrorResponse(http.StatusBadRequest, err)
+	}
+	status, err := svc.repo.RequestEmailOTP(ctx, email)
+	if err != nil {
+		return nil, models.NewErrorResponse(status, err)
+	}
+	return &models.Response{Success: true, Status: status, Data: "if an account exists for this email, a login code was sent to it"}, nil
+}
+
+func (svc *AuthService) VerifyEmailOTP(ctx context.Context, body *models.EmailOTPReqBody) (*models.TokenResponse, *models.ErrorResponse) {
+	if body.Email == "" || body.Code == "" {
+		return nil, models.NewErrorResponse(http.StatusBadRequest, fmt.Errorf("please provide the email and the code"))
+	}
+	tokenRes, status, err := svc.repo.VerifyEmailOTP(ctx, validator.NormalizeEmail(body.Email), strings.TrimSpace(body.Code))
 	if err != nil {
 		return nil, models.NewErrorResponse(status, err)
 	}
@@ -8,9 +8,37 @@ import (
 
 type AuthServiceInterface interface {
 	CreateUser(ctx context.Context, body *models.AuthReqBody) (*models.Response, *models.ErrorResponse)
-	LogoutUser(ctx context.Context, userID int) (*models.Response, *models.ErrorResponse)
-	DeleteUser(ctx context.Context, userID int) (*models.Response, *models.ErrorResponse)
+	LogoutUser(ctx context.Context, userID int, sessionID string, accessTokenID string, accessTokenExpire int64) (*models.Response, *models.ErrorResponse)
+	RevokeAccessToken(ctx context.Context, body *models.RevokeAccessTokenReqBody) (*models.Response, *models.ErrorResponse)
+	DeleteUser(ctx context.Context, userID int, accessTokenID string, accessTokenExpire int64) (*models.Response, *models.ErrorResponse)
 	GetUserByID(ctx context.Context, userID int) (*models.Response, *models.ErrorResponse)
 	LoginUser(ctx context.Context, body *models.AuthReqBody) (*models.TokenResponse, *models.ErrorResponse)
-	GenerateTokens(ctx context.Context, userID int, oldRefreshToken string) (*models.TokenResponse, *models.ErrorResponse)
+	GenerateTokens(ctx context.Context, oldRefreshToken string) (*models.TokenResponse, *models.ErrorResponse)
+	IntrospectToken(ctx context.Context, token string, tokenTypeHint string) (*models.IntrospectionResponse, *models.ErrorResponse)
+	RevokeToken(ctx context.Context, token string, tokenTypeHint string) (*models.Response, *models.ErrorResponse)
+	VerifyEmail(ctx context.Context, body *models.TokenReqBody) (*models.Response, *models.ErrorResponse)
+	ResendVerificationEmail(ctx context.Context, body *models.EmailReqBody) (*models.Response, *models.ErrorResponse)
+	ForgotPassword(ctx context.Context, body *models.EmailReqBody) (*models.Response, *models.ErrorResponse)
+	ResetPassword(ctx context.Context, body *models.ResetPasswordReqBody) (*models.Response, *models.ErrorResponse)
+	ChangePassword(ctx context.Context, userID int, sessionID string, body *models.ChangePasswordReqBody) (*models.Response, *models.ErrorResponse)
+	RequestEmailChange(ctx context.Context, userID int, body *models.ChangeEmailReqBody) (*models.Response, *models.ErrorResponse)
+	ConfirmEmailChange(ctx context.Context, body *models.TokenReqBody) (*models.Response, *models.ErrorResponse)
+	CancelEmailChange(ctx context.Context, body *models.TokenReqBody) (*models.Response, *models.ErrorResponse)
+	UnlockAccount(ctx context.Context, body *models.TokenReqBody) (*models.Response, *models.ErrorResponse)
+	UnlockUser(ctx context.Context, userID int) (*models.Response, *models.ErrorResponse)
+	EnrollTOTP(ctx context.Context, userID int) (*models.Response, *models.ErrorResponse)
+	ConfirmTOTP(ctx context.Context, userID int, body *models.MFACodeReqBody) (*models.Response, *models.ErrorResponse)
+	DisableTOTP(ctx context.Context, userID int, body *models.DisableMFAReqBody) (*models.Response, *models.ErrorResponse)
+	RegenerateRecoveryCodes(ctx context.Context, userID int, body *models.MFACodeReqBody) (*models.Response, *models.ErrorResponse)
+	LoginMFA(ctx context.Context, body *models.MFALoginReqBody) (*models.TokenResponse, *models.ErrorResponse)
+	BeginWebAuthnRegistration(ctx context.Context, userID int) (*models.Response, *models.ErrorResponse)
+	FinishWebAuthnRegistration(ctx context.Context, userID int, body *models.WebAuthnRegisterReqBody) (*models.Response, *models.ErrorResponse)
+	BeginWebAuthnLogin(ctx context.Context, body *models.EmailReqBody) (*models.Response, *models.ErrorResponse)
+	FinishWebAuthnLogin(ctx context.Context, body *models.WebAuthnLoginReqBody) (*models.TokenResponse, *models.ErrorResponse)
+	GetWebAuthnCredentials(ctx context.Context, userID int) (*models.Response, *models.ErrorResponse)
+	DeleteWebAuthnCredential(ctx context.Context, userID int, credentialID int) (*models.Response, *models.ErrorResponse)
+	RequestMagicLink(ctx context.Context, body *models.EmailReqBody) (*models.MagicLinkResponse, *models.ErrorResponse)
+	VerifyMagicLink(ctx context.Context, body *models.TokenReqBody, nonce string) (*models.TokenResponse, *models.ErrorResponse)
+	RequestEmailOTP(ctx context.Context, body *models.EmailReqBody) (*models.Response, *models.ErrorResponse)
+	VerifyEmailOTP(ctx context.Context, body *models.EmailOTPReqBody) (*models.TokenResponse, *models.ErrorResponse)
 }
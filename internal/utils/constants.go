@@ -3,5 +3,24 @@ package utils
 type StringKey string
 
 const (
-	UserIDCtxKey StringKey = "userID"
+	UserIDCtxKey          StringKey = "userID"
+	SessionIDCtxKey       StringKey = "sessionID"
+	TokenIDCtxKey         StringKey = "tokenID"
+	TokenExpireTimeCtxKey StringKey = "tokenExpireTime"
+	ClientIPCtxKey        StringKey = "clientIP"
+)
+
+// Values of the typ claim, which tells access tokens, refresh tokens and the single-use
+// tokens for actions confirmed by email or a second factor apart.
+const (
+	AccessTokenType            = "access"
+	RefreshTokenType           = "refresh"
+	EmailVerificationTokenType = "email_verification"
+	PasswordResetTokenType     = "password_reset"
+	EmailChangeTokenType       = "email_change"
+	EmailChangeCancelTokenType = "email_change_cancel"
+	AccountUnlockTokenType     = "account_unlock"
+	MFAPendingTokenType        = "mfa_pending"
+	MagicLinkTokenType         = "magic_link"
+	EmailOTPTokenType          = "email_otp"
 )
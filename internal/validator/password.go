@@ -0,0 +1,141 @@
+package validator
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/breach"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/config"
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/utils"
+)
+
+var (
+	policyOnce sync.Once
+	policy     *PasswordPolicy
+)
+
+// commonPasswords are always banned, PASSWORD_BANNED_FILE can add more.
+var commonPasswords = []string{
+	"password", "password1", "password123", "passw0rd", "12345678", "123456789", "1234567890",
+	"qwerty123", "qwertyuiop", "1q2w3e4r", "1qaz2wsx", "iloveyou", "abc12345", "11111111",
+	"00000000", "87654321", "letmein1", "welcome1", "trustno1", "changeme", "sunshine",
+	"princess", "football", "baseball", "superman", "starwars", "whatever", "administrator",
+}
+
+// PasswordPolicy is the policy every new password has to satisfy, configured by the PASSWORD_* variables.
+type PasswordPolicy struct {
+	minLength       int
+	maxLength       int
+	requiredClasses []string
+	banned          map[string]struct{}
+	breached        breach.BreachCheckerInterface
+}
+
+// NewPasswordPolicy returns the singleton password policy.
+// If PASSWORD_BANNED_FILE or BREACHED_PASSWORDS_FILE can't be read, it will panic.
+func NewPasswordPolicy() *PasswordPolicy {
+	policyOnce.Do(func() {
+		p := &PasswordPolicy{
+			minLength:       config.Envs.PASSWORD_MIN_LENGTH,
+			maxLength:       config.Envs.PASSWORD_MAX_LENGTH,
+			requiredClasses: config.Envs.PASSWORD_REQUIRED_CLASSES,
+			banned:          map[string]struct{}{},
+			breached:        breach.NewBreachChecker(),
+		}
+		for _, password := range commonPasswords {
+			p.banned[password] = struct{}{}
+		}
+		if config.Envs.PASSWORD_BANNED_FILE != "" {
+			if err := p.loadBanned(config.Envs.PASSWORD_BANNED_FILE); err != nil {
+				utils.Log.Error("error loading banned passwords", "file", config.Envs.PASSWORD_BANNED_FILE, "error", err)
+				panic(err)
+			}
+		}
+		policy = p
+	})
+	return policy
+}
+
+// loadBanned adds the passwords of a file, one per line, to the banned passwords.
+func (p *PasswordPolicy) loadBanned(name string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if password := strings.TrimSpace(scanner.Text()); password != "" {
+			p.banned[strings.ToLower(password)] = struct{}{}
+		}
+	}
+	return scanner.Err()
+}
+
+// Check returns every rule of the policy a password breaks, or nothing if it satisfies the policy.
+// email is the email address of the account, it may be empty if it isn't known.
+func (p *PasswordPolicy) Check(password string, email string) []string {
+	var problems []string
+	if utf8.RuneCountInString(password) < p.minLength {
+		problems = append(problems, fmt.Sprintf("must be at least %d characters long", p.minLength))
+	}
+	// The maximum counts bytes, as that is what bcrypt truncates and what hashing time depends on.
+	if len(password) > p.maxLength {
+		problems = append(problems, fmt.Sprintf("must be at most %d bytes long", p.maxLength))
+	}
+
+	for _, class := range p.requiredClasses {
+		if !containsClass(password, class) {
+			problems = append(problems, "must contain "+classNames[class])
+		}
+	}
+
+	lower := strings.ToLower(password)
+	if _, ok := p.banned[lower]; ok {
+		problems = append(problems, "is too common, please choose another one")
+	} else if p.breached.IsBreached(password) {
+		problems = append(problems, "has appeared in a data breach, please choose another one")
+	}
+	if isSimilarToEmail(lower, email) {
+		problems = append(problems, "must not contain your email address")
+	}
+	return problems
+}
+
+var classNames = map[string]string{
+	"lower":  "a lowercase letter",
+	"upper":  "an uppercase letter",
+	"digit":  "a digit",
+	"symbol": "a symbol",
+}
+
+// containsClass reports whether a password contains a character of the given class.
+func containsClass(password string, class string) bool {
+	for _, c := range password {
+		switch {
+		case class == "lower" && unicode.IsLower(c),
+			class == "upper" && unicode.IsUpper(c),
+			class == "digit" && unicode.IsDigit(c),
+			class == "symbol" && !unicode.IsLetter(c) && !unicode.IsDigit(c):
+			return true
+		}
+	}
+	return false
+}
+
+// isSimilarToEmail reports whether a lowercased password contains the email address or its local part.
+// Local parts shorter than 3 characters are ignored, they would reject too many passwords.
+func isSimilarToEmail(password string, email string) bool {
+	email = strings.ToLower(email)
+	if email == "" {
+		return false
+	}
+	local, _, _ := strings.Cut(email, "@")
+	return strings.Contains(password, email) || (len(local) >= 3 && strings.Contains(password, local))
+}
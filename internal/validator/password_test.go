@@ -0,0 +1,108 @@
+package validator
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// breachedPasswords is a breach checker which knows a fixed set of passwords.
+type breachedPasswords []string
+
+func (b breachedPasswords) IsBreached(password string) bool {
+	return slices.Contains(b, password)
+}
+
+func newTestPolicy(requiredClasses ...string) *PasswordPolicy {
+	p := &PasswordPolicy{
+		minLength:       8,
+		maxLength:       72,
+		requiredClasses: requiredClasses,
+		banned:          map[string]struct{}{},
+		breached:        breachedPasswords{"Tr0ub4dor&3"},
+	}
+	for _, password := range commonPasswords {
+		p.banned[password] = struct{}{}
+	}
+	return p
+}
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	tests := []struct {
+		name            string
+		password        string
+		email           string
+		requiredClasses []string
+		want            []string
+	}{
+		{name: "valid", password: "correct horse battery", email: "jane@example.com"},
+		{name: "too short", password: "shorty", want: []string{"must be at least 8 characters long"}},
+		{name: "length counts characters", password: "äöüßäöüß"},
+		{name: "too long", password: strings.Repeat("a", 73), want: []string{"must be at most 72 bytes long"}},
+		{name: "common", password: "Password123", want: []string{"is too common, please choose another one"}},
+		{name: "breached", password: "Tr0ub4dor&3", want: []string{"has appeared in a data breach, please choose another one"}},
+		{name: "contains the email", password: "x-jane@example.com-x", email: "jane@example.com", want: []string{"must not contain your email address"}},
+		{name: "contains the local part", password: "i am JANE doe", email: "Jane@example.com", want: []string{"must not contain your email address"}},
+		{name: "short local part is ignored", password: "joe's password", email: "jo@example.com"},
+		{
+			name:            "required classes",
+			password:        "only lowercase",
+			requiredClasses: []string{"lower", "upper", "digit", "symbol"},
+			want:            []string{"must contain an uppercase letter", "must contain a digit"},
+		},
+		{
+			name:            "every problem",
+			password:        "jane",
+			email:           "jane@example.com",
+			requiredClasses: []string{"digit"},
+			want:            []string{"must be at least 8 characters long", "must contain a digit", "must not contain your email address"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newTestPolicy(tt.requiredClasses...).Check(tt.password, tt.email)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Check(%q) = %q, want %q", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyBannedFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "banned.txt")
+	if err := os.WriteFile(name, []byte("CompanyName2024\n\n  hunter2hunter2  \n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	p := newTestPolicy()
+	if err := p.loadBanned(name); err != nil {
+		t.Fatal(err)
+	}
+	for _, password := range []string{"companyname2024", "COMPANYNAME2024", "hunter2hunter2"} {
+		if problems := p.Check(password, ""); !slices.Contains(problems, "is too common, please choose another one") {
+			t.Errorf("Check(%q) = %q, want it banned", password, problems)
+		}
+	}
+}
+
+func TestCheckEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		want  string
+	}{
+		{email: "jane@example.com"},
+		{email: "jane.doe+tag@mail.example.co.uk"},
+		{email: "jane", want: "is not a valid email address"},
+		{email: "jane@localhost", want: "is not a valid email address"},
+		{email: "jane@example.", want: "is not a valid email address"},
+		{email: "Jane <jane@example.com>", want: "is not a valid email address"},
+		{email: strings.Repeat("a", 65) + "@example.com", want: "is not a valid email address"},
+		{email: "jane@" + strings.Repeat("a", 250) + ".com", want: "is too long"},
+	}
+	for _, tt := range tests {
+		if got := checkEmail(tt.email); got != tt.want {
+			t.Errorf("checkEmail(%q) = %q, want %q", tt.email, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package validator
+
+import (
+	"net/mail"
+	"strings"
+
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/models"
+)
+
+// Validator collects the field errors of a request body.
+type Validator struct {
+	errors models.FieldErrors
+}
+
+func New() *Validator {
+	return &Validator{}
+}
+
+// AddError adds an error for a field.
+func (v *Validator) AddError(field string, message string) {
+	v.errors = append(v.errors, models.FieldError{Field: field, Message: message})
+}
+
+// Required checks that a field isn't empty and reports whether it is set.
+func (v *Validator) Required(field string, value string) bool {
+	if value == "" {
+		v.AddError(field, "is required")
+		return false
+	}
+	return true
+}
+
+// Email checks that a field holds a valid email address. The address has to be normalised with NormalizeEmail first.
+func (v *Validator) Email(field string, email string) {
+	if !v.Required(field, email) {
+		return
+	}
+	if message := checkEmail(email); message != "" {
+		v.AddError(field, message)
+	}
+}
+
+// Password checks that a field holds a password which satisfies the password policy.
+// email is the email address of the account, it may be empty if it isn't known.
+func (v *Validator) Password(field string, password string, email string) {
+	if !v.Required(field, password) {
+		return
+	}
+	for _, message := range NewPasswordPolicy().Check(password, email) {
+		v.AddError(field, message)
+	}
+}
+
+// Err returns the collected errors as models.FieldErrors, or nil if every field is valid.
+func (v *Validator) Err() error {
+	if len(v.errors) == 0 {
+		return nil
+	}
+	return v.errors
+}
+
+// CheckPassword checks a single password field against the password policy, see Validator.Password.
+func CheckPassword(field string, password string, email string) error {
+	v := New()
+	v.Password(field, password, email)
+	return v.Err()
+}
+
+// NormalizeEmail trims and lowercases an email address. Addresses are compared case-insensitively,
+// so every address is normalised before it is stored or looked up.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// checkEmail returns why an email address is invalid, or an empty string if it is valid.
+func checkEmail(email string) string {
+	if len(email) > 254 {
+		return "is too long"
+	}
+	// ParseAddress also accepts display names and comments, so the parsed address has to be the whole input.
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "is not a valid email address"
+	}
+	local, domain, _ := strings.Cut(email, "@")
+	if len(local) > 64 || !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return "is not a valid email address"
+	}
+	return ""
+}
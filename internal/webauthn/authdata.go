@@ -0,0 +1,69 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Flags of the authenticator data.
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+// authenticatorData is the parsed authenticator data of a registration or an assertion.
+type authenticatorData struct {
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+	// Only set for registrations, which carry the attested credential data.
+	aaguid       []byte
+	credentialID []byte
+	publicKey    []byte
+}
+
+// parseAuthenticatorData parses the binary authenticator data: the SHA-256 hash of the RP ID, the flags,
+// the signature counter and, when the AT flag is set, the attested credential data with the
+// credential ID and the COSE public key. Extensions are ignored.
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, fmt.Errorf("authenticator data too short")
+	}
+	authData := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if authData.flags&flagAttestedData == 0 {
+		return authData, nil
+	}
+
+	rest := data[37:]
+	if len(rest) < 18 {
+		return nil, fmt.Errorf("attested credential data too short")
+	}
+	authData.aaguid = rest[:16]
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLength == 0 || idLength > 1023 || len(rest) < idLength {
+		return nil, fmt.Errorf("invalid credential id")
+	}
+	authData.credentialID = rest[:idLength]
+	rest = rest[idLength:]
+
+	_, afterKey, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credential public key: %w", err)
+	}
+	authData.publicKey = rest[:len(rest)-len(afterKey)]
+	return authData, nil
+}
+
+func (d *authenticatorData) userPresent() bool {
+	return d.flags&flagUserPresent != 0
+}
+
+func (d *authenticatorData) userVerified() bool {
+	return d.flags&flagUserVerified != 0
+}
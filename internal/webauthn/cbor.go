@@ -0,0 +1,161 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// maxCBORDepth limits the nesting of decoded CBOR, authenticators never nest deeper than a few levels.
+const maxCBORDepth = 16
+
+var errCBORTruncated = fmt.Errorf("cbor: unexpected end of data")
+
+// decodeCBOR decodes the first CBOR item (RFC 8949) of data and returns it along with the remaining bytes.
+// It covers what WebAuthn uses: integers are decoded as int64, byte strings as []byte, text strings as string,
+// arrays as []any and maps as map[any]any with int64 or string keys. Tags are skipped, indefinite lengths
+// are not supported.
+func decodeCBOR(data []byte) (any, []byte, error) {
+	return decodeCBORItem(data, 0)
+}
+
+func decodeCBORItem(data []byte, depth int) (any, []byte, error) {
+	if depth > maxCBORDepth {
+		return nil, nil, fmt.Errorf("cbor: nested too deeply")
+	}
+	if len(data) == 0 {
+		return nil, nil, errCBORTruncated
+	}
+	major, info := data[0]>>5, data[0]&0x1f
+	if major == 7 {
+		return decodeCBORSimple(data)
+	}
+	arg, rest, err := decodeCBORArgument(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("cbor: integer overflow")
+		}
+		return int64(arg), rest, nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("cbor: integer overflow")
+		}
+		return -1 - int64(arg), rest, nil
+	case 2, 3:
+		if arg > uint64(len(rest)) {
+			return nil, nil, errCBORTruncated
+		}
+		if major == 2 {
+			return rest[:arg], rest[arg:], nil
+		}
+		return string(rest[:arg]), rest[arg:], nil
+	case 4:
+		// Every item takes at least one byte, which bounds the allocation.
+		if arg > uint64(len(rest)) {
+			return nil, nil, errCBORTruncated
+		}
+		items := make([]any, arg)
+		for i := range items {
+			items[i], rest, err = decodeCBORItem(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		return items, rest, nil
+	case 5:
+		if arg > uint64(len(rest)) {
+			return nil, nil, errCBORTruncated
+		}
+		items := make(map[any]any, arg)
+		for i := uint64(0); i < arg; i++ {
+			var key, value any
+			key, rest, err = decodeCBORItem(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, fmt.Errorf("cbor: unsupported map key type %T", key)
+			}
+			if _, ok := items[key]; ok {
+				return nil, nil, fmt.Errorf("cbor: duplicate map key %v", key)
+			}
+			value, rest, err = decodeCBORItem(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items[key] = value
+		}
+		return items, rest, nil
+	default:
+		// Tags only annotate the item which follows them.
+		if info == 31 {
+			return nil, nil, fmt.Errorf("cbor: indefinite length tag")
+		}
+		return decodeCBORItem(rest, depth+1)
+	}
+}
+
+// decodeCBORArgument decodes the argument of an item header, a length or an integer value.
+func decodeCBORArgument(data []byte) (uint64, []byte, error) {
+	info := data[0] & 0x1f
+	data = data[1:]
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info == 24:
+		if len(data) < 1 {
+			return 0, nil, errCBORTruncated
+		}
+		return uint64(data[0]), data[1:], nil
+	case info == 25:
+		if len(data) < 2 {
+			return 0, nil, errCBORTruncated
+		}
+		return uint64(binary.BigEndian.Uint16(data)), data[2:], nil
+	case info == 26:
+		if len(data) < 4 {
+			return 0, nil, errCBORTruncated
+		}
+		return uint64(binary.BigEndian.Uint32(data)), data[4:], nil
+	case info == 27:
+		if len(data) < 8 {
+			return 0, nil, errCBORTruncated
+		}
+		return binary.BigEndian.Uint64(data), data[8:], nil
+	default:
+		return 0, nil, fmt.Errorf("cbor: unsupported additional information %d", info)
+	}
+}
+
+// decodeCBORSimple decodes the simple values false, true, null and undefined and floating point numbers.
+func decodeCBORSimple(data []byte) (any, []byte, error) {
+	info := data[0] & 0x1f
+	rest := data[1:]
+	switch info {
+	case 20:
+		return false, rest, nil
+	case 21:
+		return true, rest, nil
+	case 22, 23:
+		return nil, rest, nil
+	case 26:
+		if len(rest) < 4 {
+			return nil, nil, errCBORTruncated
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(rest))), rest[4:], nil
+	case 27:
+		if len(rest) < 8 {
+			return nil, nil, errCBORTruncated
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(rest)), rest[8:], nil
+	default:
+		return nil, nil, fmt.Errorf("cbor: unsupported simple value %d", info)
+	}
+}
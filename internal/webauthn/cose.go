@@ -0,0 +1,124 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithm identifiers (RFC 9053) of the credential keys accepted for passkeys.
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// COSE key parameters and values (RFC 9052).
+const (
+	coseKeyType   = 1
+	coseAlgorithm = 3
+	coseCurve     = -1
+	coseX         = -2
+	coseY         = -3
+	coseRSAN      = -1
+	coseRSAE      = -2
+
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseCurveP256    = 1
+	coseCurveEd25519 = 6
+)
+
+// publicKey is a parsed COSE credential public key.
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// parsePublicKey parses a CBOR encoded COSE_Key of one of the supported algorithms.
+func parsePublicKey(data []byte) (*publicKey, error) {
+	item, rest, err := decodeCBOR(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("trailing data after public key")
+	}
+	params, ok := item.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("public key is not a map")
+	}
+	kty, _ := params[int64(coseKeyType)].(int64)
+	alg, _ := params[int64(coseAlgorithm)].(int64)
+
+	switch {
+	case kty == coseKeyTypeEC2 && alg == AlgES256:
+		crv, _ := params[int64(coseCurve)].(int64)
+		x, _ := params[int64(coseX)].([]byte)
+		y, _ := params[int64(coseY)].([]byte)
+		if crv != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("invalid ES256 public key")
+		}
+		// crypto/ecdh checks that the point is on the curve.
+		point := append(append([]byte{4}, x...), y...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, fmt.Errorf("invalid ES256 public key")
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		return &publicKey{alg: alg, key: key}, nil
+	case kty == coseKeyTypeOKP && alg == AlgEdDSA:
+		crv, _ := params[int64(coseCurve)].(int64)
+		x, _ := params[int64(coseX)].([]byte)
+		if crv != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid EdDSA public key")
+		}
+		return &publicKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+	case kty == coseKeyTypeRSA && alg == AlgRS256:
+		n, _ := params[int64(coseRSAN)].([]byte)
+		e, _ := params[int64(coseRSAE)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid RS256 public key")
+		}
+		exponent := int(new(big.Int).SetBytes(e).Int64())
+		return &publicKey{alg: alg, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %d with algorithm %d", kty, alg)
+	}
+}
+
+// verify checks a signature of the key over data.
+func (k *publicKey) verify(data []byte, sig []byte) error {
+	return verifySignature(k.alg, k.key, data, sig)
+}
+
+// verifySignature checks a signature over data made with the COSE algorithm alg.
+func verifySignature(alg int64, key crypto.PublicKey, data []byte, sig []byte) error {
+	valid := false
+	switch alg {
+	case AlgES256:
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		digest := sha256.Sum256(data)
+		valid = ok && ecdsa.VerifyASN1(ecKey, digest[:], sig)
+	case AlgEdDSA:
+		edKey, ok := key.(ed25519.PublicKey)
+		valid = ok && ed25519.Verify(edKey, data, sig)
+	case AlgRS256:
+		rsaKey, ok := key.(*rsa.PublicKey)
+		digest := sha256.Sum256(data)
+		valid = ok && rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], sig) == nil
+	default:
+		return fmt.Errorf("unsupported algorithm %d", alg)
+	}
+	if !valid {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package webauthn
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Base64URL is binary data encoded as unpadded base64url in JSON, the encoding of
+// PublicKeyCredential.toJSON() and of the options passed to PublicKeyCredential.parse*OptionsFromJSON().
+type Base64URL []byte
+
+func (b Base64URL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *Base64URL) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return fmt.Errorf("invalid base64url value")
+	}
+	*b = decoded
+	return nil
+}
+
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          Base64URL `json:"id"`
+	Name        string    `json:"name"`
+	DisplayName string    `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type       string    `json:"type"`
+	ID         Base64URL `json:"id"`
+	Transports []string  `json:"transports,omitempty"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// CreationOptions are the PublicKeyCredentialCreationOptions of a registration ceremony.
+type CreationOptions struct {
+	RP                     RelyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	Challenge              Base64URL              `json:"challenge"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are the PublicKeyCredentialRequestOptions of an authentication ceremony.
+type RequestOptions struct {
+	Challenge        Base64URL              `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// CredentialCreationResponse is the credential created by navigator.credentials.create(), serialized with toJSON().
+type CredentialCreationResponse struct {
+	ID       string                      `json:"id"`
+	RawID    Base64URL                   `json:"rawId"`
+	Type     string                      `json:"type"`
+	Response AuthenticatorAttestationRes `json:"response"`
+}
+
+type AuthenticatorAttestationRes struct {
+	ClientDataJSON    Base64URL `json:"clientDataJSON"`
+	AttestationObject Base64URL `json:"attestationObject"`
+	Transports        []string  `json:"transports"`
+}
+
+// CredentialAssertionResponse is the assertion returned by navigator.credentials.get(), serialized with toJSON().
+type CredentialAssertionResponse struct {
+	ID       string                    `json:"id"`
+	RawID    Base64URL                 `json:"rawId"`
+	Type     string                    `json:"type"`
+	Response AuthenticatorAssertionRes `json:"response"`
+}
+
+type AuthenticatorAssertionRes struct {
+	ClientDataJSON    Base64URL `json:"clientDataJSON"`
+	AuthenticatorData Base64URL `json:"authenticatorData"`
+	Signature         Base64URL `json:"signature"`
+	UserHandle        Base64URL `json:"userHandle"`
+}
+
+// ClientData is the parsed clientDataJSON, which the browser signs over along with the authenticator data.
+type ClientData struct {
+	Type        string    `json:"type"`
+	Challenge   Base64URL `json:"challenge"`
+	Origin      string    `json:"origin"`
+	CrossOrigin bool      `json:"crossOrigin"`
+}
+
+// ParseClientData parses the clientDataJSON of a ceremony. Its challenge identifies the ceremony,
+// so the stored challenge can be looked up before the response is verified.
+func ParseClientData(clientDataJSON []byte) (*ClientData, error) {
+	clientData := &ClientData{}
+	if err := json.Unmarshal(clientDataJSON, clientData); err != nil {
+		return nil, fmt.Errorf("invalid client data")
+	}
+	if len(clientData.Challenge) == 0 {
+		return nil, fmt.Errorf("missing challenge")
+	}
+	return clientData, nil
+}
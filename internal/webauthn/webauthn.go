@@ -0,0 +1,269 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/the-arcade-01/golang-jwt-authentication/internal/config"
+)
+
+var (
+	relyingPartyOnce sync.Once
+	relyingParty     RelyingPartyInterface
+)
+
+// ErrSignCount is returned for an assertion whose signature counter didn't increase, which means
+// the authenticator was most likely cloned.
+var ErrSignCount = fmt.Errorf("signature counter did not increase")
+
+// RelyingPartyInterface runs the server side of the WebAuthn registration and authentication ceremonies
+// (https://www.w3.org/TR/webauthn-2/). Storing challenges and credentials is left to the caller.
+type RelyingPartyInterface interface {
+	CreationOptions(user UserEntity, challenge []byte, exclude []CredentialDescriptor) *CreationOptions
+	RequestOptions(challenge []byte, allow []CredentialDescriptor) *RequestOptions
+	VerifyRegistration(res *CredentialCreationResponse, challenge []byte) (*Credential, error)
+	VerifyAssertion(res *CredentialAssertionResponse, challenge []byte, credential *Credential) (uint32, error)
+}
+
+// Credential is a registered passkey: its ID, its COSE encoded public key and the last signature counter.
+type Credential struct {
+	ID         []byte
+	PublicKey  []byte
+	SignCount  uint32
+	Transports []string
+}
+
+// NewRelyingParty returns the singleton relying party of WEBAUTHN_RP_ID, accepting ceremonies from WEBAUTHN_ORIGINS.
+// Passkeys are discoverable credentials and every ceremony requires user verification (a PIN or biometrics),
+// so a passkey counts as both factors of a login.
+func NewRelyingParty() RelyingPartyInterface {
+	relyingPartyOnce.Do(func() {
+		relyingParty = &RelyingParty{
+			id:      config.Envs.WEBAUTHN_RP_ID,
+			name:    config.Envs.WEBAUTHN_RP_NAME,
+			origins: config.Envs.WEBAUTHN_ORIGINS,
+			timeout: time.Duration(config.Envs.WEBAUTHN_CHALLENGE_EXPIRE) * time.Minute,
+		}
+	})
+	return relyingParty
+}
+
+type RelyingParty struct {
+	id      string
+	name    string
+	origins []string
+	timeout time.Duration
+}
+
+// NewChallenge returns a random challenge for a ceremony.
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+func (rp *RelyingParty) CreationOptions(user UserEntity, challenge []byte, exclude []CredentialDescriptor) *CreationOptions {
+	return &CreationOptions{
+		RP:        RelyingPartyEntity{ID: rp.id, Name: rp.name},
+		User:      user,
+		Challenge: challenge,
+		PubKeyCredParams: []CredentialParameter{
+			{Type: "public-key", Alg: AlgES256},
+			{Type: "public-key", Alg: AlgEdDSA},
+			{Type: "public-key", Alg: AlgRS256},
+		},
+		Timeout:            rp.timeout.Milliseconds(),
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:        "required",
+			RequireResidentKey: true,
+			UserVerification:   "required",
+		},
+		Attestation: "none",
+	}
+}
+
+func (rp *RelyingParty) RequestOptions(challenge []byte, allow []CredentialDescriptor) *RequestOptions {
+	return &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          rp.timeout.Milliseconds(),
+		RPID:             rp.id,
+		AllowCredentials: allow,
+		UserVerification: "required",
+	}
+}
+
+// VerifyRegistration verifies the response of a registration ceremony for the given challenge
+// and returns the new credential. Attestation statements of the "none" and "packed" formats are
+// accepted; a packed statement's signature is checked, but its certificate isn't checked against
+// trust roots, as the options ask for no attestation.
+func (rp *RelyingParty) VerifyRegistration(res *CredentialCreationResponse, challenge []byte) (*Credential, error) {
+	if res.Type != "public-key" {
+		return nil, fmt.Errorf("invalid credential type")
+	}
+	if err := rp.verifyClientData(res.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	item, rest, err := decodeCBOR(res.Response.AttestationObject)
+	if err != nil || len(rest) != 0 {
+		return nil, fmt.Errorf("invalid attestation object")
+	}
+	attestation, ok := item.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid attestation object")
+	}
+	format, _ := attestation["fmt"].(string)
+	rawAuthData, _ := attestation["authData"].([]byte)
+	statement, _ := attestation["attStmt"].(map[any]any)
+	if statement == nil {
+		return nil, fmt.Errorf("invalid attestation statement")
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(authData); err != nil {
+		return nil, err
+	}
+	if authData.credentialID == nil {
+		return nil, fmt.Errorf("missing attested credential data")
+	}
+	if !bytes.Equal(authData.credentialID, res.RawID) {
+		return nil, fmt.Errorf("credential id mismatch")
+	}
+	key, err := parsePublicKey(authData.publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(res.Response.ClientDataJSON)
+	signed := append(append([]byte{}, rawAuthData...), clientDataHash[:]...)
+	switch format {
+	case "none":
+		if len(statement) != 0 {
+			return nil, fmt.Errorf("invalid attestation statement")
+		}
+	case "packed":
+		if err := verifyPackedAttestation(statement, key, signed); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported attestation format %q", format)
+	}
+
+	return &Credential{
+		ID:         authData.credentialID,
+		PublicKey:  authData.publicKey,
+		SignCount:  authData.signCount,
+		Transports: res.Response.Transports,
+	}, nil
+}
+
+// VerifyAssertion verifies the response of an authentication ceremony for the given challenge against the
+// stored credential and returns the new signature counter. Authenticators with a counter have to increase it
+// with every assertion, otherwise ErrSignCount is returned. Authenticators without one always report 0.
+func (rp *RelyingParty) VerifyAssertion(res *CredentialAssertionResponse, challenge []byte, credential *Credential) (uint32, error) {
+	if res.Type != "public-key" {
+		return 0, fmt.Errorf("invalid credential type")
+	}
+	if !bytes.Equal(res.RawID, credential.ID) {
+		return 0, fmt.Errorf("credential id mismatch")
+	}
+	if err := rp.verifyClientData(res.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	authData, err := parseAuthenticatorData(res.Response.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+	if err := rp.verifyAuthenticatorData(authData); err != nil {
+		return 0, err
+	}
+
+	key, err := parsePublicKey(credential.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(res.Response.ClientDataJSON)
+	signed := append(append([]byte{}, res.Response.AuthenticatorData...), clientDataHash[:]...)
+	if err := key.verify(signed, res.Response.Signature); err != nil {
+		return 0, err
+	}
+
+	if (authData.signCount != 0 || credential.SignCount != 0) && authData.signCount <= credential.SignCount {
+		return 0, ErrSignCount
+	}
+	return authData.signCount, nil
+}
+
+// verifyClientData checks the type, the challenge and the origin of the client data.
+func (rp *RelyingParty) verifyClientData(clientDataJSON []byte, ceremony string, challenge []byte) error {
+	clientData, err := ParseClientData(clientDataJSON)
+	if err != nil {
+		return err
+	}
+	if clientData.Type != ceremony {
+		return fmt.Errorf("invalid client data type")
+	}
+	if subtle.ConstantTimeCompare(clientData.Challenge, challenge) != 1 {
+		return fmt.Errorf("challenge mismatch")
+	}
+	if !slices.Contains(rp.origins, clientData.Origin) {
+		return fmt.Errorf("origin %q is not allowed", clientData.Origin)
+	}
+	return nil
+}
+
+// verifyAuthenticatorData checks that the authenticator data is scoped to the RP ID and that the user was
+// present and verified.
+func (rp *RelyingParty) verifyAuthenticatorData(authData *authenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(rp.id))
+	if !bytes.Equal(authData.rpIDHash, rpIDHash[:]) {
+		return fmt.Errorf("rp id mismatch")
+	}
+	if !authData.userPresent() {
+		return fmt.Errorf("user not present")
+	}
+	if !authData.userVerified() {
+		return fmt.Errorf("user not verified")
+	}
+	return nil
+}
+
+// verifyPackedAttestation checks the signature of a packed attestation statement, made with the attestation
+// certificate (x5c) or, for self attestation, with the credential key itself.
+func verifyPackedAttestation(statement map[any]any, key *publicKey, signed []byte) error {
+	alg, _ := statement["alg"].(int64)
+	sig, _ := statement["sig"].([]byte)
+	if len(sig) == 0 {
+		return fmt.Errorf("invalid attestation statement")
+	}
+	chain, ok := statement["x5c"].([]any)
+	if !ok {
+		if alg != key.alg {
+			return fmt.Errorf("attestation algorithm mismatch")
+		}
+		return key.verify(signed, sig)
+	}
+	if len(chain) == 0 {
+		return fmt.Errorf("invalid attestation statement")
+	}
+	der, _ := chain[0].([]byte)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("invalid attestation certificate")
+	}
+	return verifySignature(alg, cert.PublicKey, signed, sig)
+}
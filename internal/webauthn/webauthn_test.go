@@ -0,0 +1,439 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://example.com"
+)
+
+func newTestRelyingParty() *RelyingParty {
+	return &RelyingParty{id: testRPID, name: "Example", origins: []string{testOrigin}, timeout: time.Minute}
+}
+
+// cborPair is an entry of a cborMap, which keeps the order of its entries when encoded.
+type cborPair struct {
+	key   any
+	value any
+}
+
+type cborMap []cborPair
+
+// encodeCBOR encodes the subset of CBOR the authenticator below needs.
+func encodeCBOR(v any) []byte {
+	switch v := v.(type) {
+	case int:
+		if v < 0 {
+			return cborHead(1, uint64(-1-v))
+		}
+		return cborHead(0, uint64(v))
+	case []byte:
+		return append(cborHead(2, uint64(len(v))), v...)
+	case string:
+		return append(cborHead(3, uint64(len(v))), v...)
+	case cborMap:
+		out := cborHead(5, uint64(len(v)))
+		for _, pair := range v {
+			out = append(out, encodeCBOR(pair.key)...)
+			out = append(out, encodeCBOR(pair.value)...)
+		}
+		return out
+	case []any:
+		out := cborHead(4, uint64(len(v)))
+		for _, item := range v {
+			out = append(out, encodeCBOR(item)...)
+		}
+		return out
+	}
+	panic("unsupported cbor value")
+}
+
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	}
+}
+
+// softAuthenticator is a software authenticator holding a single ES256 or EdDSA credential.
+type softAuthenticator struct {
+	t         *testing.T
+	alg       int
+	ecKey     *ecdsa.PrivateKey
+	edKey     ed25519.PrivateKey
+	id        []byte
+	rpID      string
+	signCount uint32
+	// countless authenticators don't implement a signature counter and always report 0.
+	countless bool
+}
+
+func newSoftAuthenticator(t *testing.T, alg int) *softAuthenticator {
+	t.Helper()
+	a := &softAuthenticator{t: t, alg: alg, id: make([]byte, 16), rpID: testRPID}
+	rand.Read(a.id)
+	var err error
+	switch alg {
+	case AlgES256:
+		a.ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, a.edKey, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func (a *softAuthenticator) coseKey() []byte {
+	if a.alg == AlgEdDSA {
+		return encodeCBOR(cborMap{{1, coseKeyTypeOKP}, {3, AlgEdDSA}, {-1, coseCurveEd25519}, {-2, []byte(a.edKey.Public().(ed25519.PublicKey))}})
+	}
+	x := a.ecKey.PublicKey.X.FillBytes(make([]byte, 32))
+	y := a.ecKey.PublicKey.Y.FillBytes(make([]byte, 32))
+	return encodeCBOR(cborMap{{1, coseKeyTypeEC2}, {3, AlgES256}, {-1, coseCurveP256}, {-2, x}, {-3, y}})
+}
+
+func (a *softAuthenticator) sign(data []byte) []byte {
+	if a.alg == AlgEdDSA {
+		return ed25519.Sign(a.edKey, data)
+	}
+	digest := sha256.Sum256(data)
+	sig, err := ecdsa.SignASN1(rand.Reader, a.ecKey, digest[:])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return sig
+}
+
+// authData builds the authenticator data, with the attested credential data for registrations.
+func (a *softAuthenticator) authData(flags byte, attested bool) []byte {
+	if !a.countless {
+		a.signCount++
+	}
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if attested {
+		data = append(data, make([]byte, 16)...)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.id)))
+		data = append(data, a.id...)
+		data = append(data, a.coseKey()...)
+	}
+	return data
+}
+
+func clientDataJSON(t *testing.T, ceremony string, challenge []byte, origin string) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]any{
+		"type":      ceremony,
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    origin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// register creates the credential for a registration ceremony, with an attestation statement of the
+// given format: "none", "packed" (self attestation) or "packed-x5c" (signed by an attestation certificate).
+func (a *softAuthenticator) register(challenge []byte, format string) *CredentialCreationResponse {
+	clientData := clientDataJSON(a.t, "webauthn.create", challenge, testOrigin)
+	authData := a.authData(flagUserPresent|flagUserVerified|flagAttestedData, true)
+	clientDataHash := sha256.Sum256(clientData)
+	signed := append(append([]byte{}, authData...), clientDataHash[:]...)
+
+	statement := cborMap{}
+	switch format {
+	case "packed":
+		statement = cborMap{{"alg", a.alg}, {"sig", a.sign(signed)}}
+	case "packed-x5c":
+		format = "packed"
+		attestationKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			a.t.Fatal(err)
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "Soft Authenticator Attestation"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		cert, err := x509.CreateCertificate(rand.Reader, template, template, &attestationKey.PublicKey, attestationKey)
+		if err != nil {
+			a.t.Fatal(err)
+		}
+		digest := sha256.Sum256(signed)
+		sig, err := ecdsa.SignASN1(rand.Reader, attestationKey, digest[:])
+		if err != nil {
+			a.t.Fatal(err)
+		}
+		statement = cborMap{{"alg", AlgES256}, {"sig", sig}, {"x5c", []any{cert}}}
+	}
+
+	return &CredentialCreationResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(a.id),
+		RawID: a.id,
+		Type:  "public-key",
+		Response: AuthenticatorAttestationRes{
+			ClientDataJSON:    clientData,
+			AttestationObject: encodeCBOR(cborMap{{"fmt", format}, {"attStmt", statement}, {"authData", authData}}),
+		},
+	}
+}
+
+// assert creates the assertion of an authentication ceremony.
+func (a *softAuthenticator) assert(challenge []byte, origin string, flags byte) *CredentialAssertionResponse {
+	clientData := clientDataJSON(a.t, "webauthn.get", challenge, origin)
+	authData := a.authData(flags, false)
+	clientDataHash := sha256.Sum256(clientData)
+	return &CredentialAssertionResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(a.id),
+		RawID: a.id,
+		Type:  "public-key",
+		Response: AuthenticatorAssertionRes{
+			ClientDataJSON:    clientData,
+			AuthenticatorData: authData,
+			Signature:         a.sign(append(append([]byte{}, authData...), clientDataHash[:]...)),
+		},
+	}
+}
+
+func newTestChallenge(t *testing.T) []byte {
+	t.Helper()
+	challenge, err := NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return challenge
+}
+
+// registerCredential runs a registration ceremony and returns the stored credential.
+func registerCredential(t *testing.T, rp *RelyingParty, a *softAuthenticator) *Credential {
+	t.Helper()
+	challenge := newTestChallenge(t)
+	credential, err := rp.VerifyRegistration(a.register(challenge, "none"), challenge)
+	if err != nil {
+		t.Fatalf("registration failed: %v", err)
+	}
+	return credential
+}
+
+func TestVerifyRegistration(t *testing.T) {
+	rp := newTestRelyingParty()
+	for _, alg := range []int{AlgES256, AlgEdDSA} {
+		for _, format := range []string{"none", "packed", "packed-x5c"} {
+			a := newSoftAuthenticator(t, alg)
+			challenge := newTestChallenge(t)
+			credential, err := rp.VerifyRegistration(a.register(challenge, format), challenge)
+			if err != nil {
+				t.Errorf("alg %d, format %s: unexpected error: %v", alg, format, err)
+				continue
+			}
+			if !bytes.Equal(credential.ID, a.id) || credential.SignCount != a.signCount {
+				t.Errorf("alg %d, format %s: unexpected credential %+v", alg, format, credential)
+			}
+			if _, err := parsePublicKey(credential.PublicKey); err != nil {
+				t.Errorf("alg %d, format %s: stored public key doesn't parse: %v", alg, format, err)
+			}
+		}
+	}
+}
+
+func TestVerifyRegistrationRejects(t *testing.T) {
+	rp := newTestRelyingParty()
+	a := newSoftAuthenticator(t, AlgES256)
+
+	challenge := newTestChallenge(t)
+	if _, err := rp.VerifyRegistration(a.register(challenge, "none"), newTestChallenge(t)); err == nil {
+		t.Error("registration for another challenge was accepted")
+	}
+
+	res := a.register(challenge, "packed")
+	res.Response.ClientDataJSON = clientDataJSON(t, "webauthn.create", challenge, "https://evil.example")
+	if _, err := rp.VerifyRegistration(res, challenge); err == nil {
+		t.Error("registration from a foreign origin was accepted")
+	}
+
+	res = a.register(challenge, "packed")
+	// Breaking the signature of the self attestation.
+	res.Response.ClientDataJSON = append(res.Response.ClientDataJSON[:len(res.Response.ClientDataJSON)-1], ' ', '}')
+	if _, err := rp.VerifyRegistration(res, challenge); err == nil {
+		t.Error("registration with an invalid attestation signature was accepted")
+	}
+}
+
+func TestVerifyAssertion(t *testing.T) {
+	rp := newTestRelyingParty()
+	for _, alg := range []int{AlgES256, AlgEdDSA} {
+		a := newSoftAuthenticator(t, alg)
+		credential := registerCredential(t, rp, a)
+
+		for i := 0; i < 3; i++ {
+			challenge := newTestChallenge(t)
+			signCount, err := rp.VerifyAssertion(a.assert(challenge, testOrigin, flagUserPresent|flagUserVerified), challenge, credential)
+			if err != nil {
+				t.Fatalf("alg %d: unexpected error: %v", alg, err)
+			}
+			if signCount != a.signCount {
+				t.Fatalf("alg %d: got sign count %d, want %d", alg, signCount, a.signCount)
+			}
+			credential.SignCount = signCount
+		}
+	}
+}
+
+func TestVerifyAssertionWithoutSignCount(t *testing.T) {
+	rp := newTestRelyingParty()
+	a := newSoftAuthenticator(t, AlgES256)
+	a.countless = true
+	credential := registerCredential(t, rp, a)
+
+	for i := 0; i < 2; i++ {
+		challenge := newTestChallenge(t)
+		if _, err := rp.VerifyAssertion(a.assert(challenge, testOrigin, flagUserPresent|flagUserVerified), challenge, credential); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestVerifyAssertionRejects(t *testing.T) {
+	rp := newTestRelyingParty()
+	uv := byte(flagUserPresent | flagUserVerified)
+
+	tests := []struct {
+		name   string
+		assert func(t *testing.T, a *softAuthenticator, challenge []byte) (*CredentialAssertionResponse, []byte)
+	}{
+		{"wrong rp id hash", func(t *testing.T, a *softAuthenticator, challenge []byte) (*CredentialAssertionResponse, []byte) {
+			a.rpID = "evil.example"
+			return a.assert(challenge, testOrigin, uv), challenge
+		}},
+		{"wrong origin", func(t *testing.T, a *softAuthenticator, challenge []byte) (*CredentialAssertionResponse, []byte) {
+			return a.assert(challenge, "https://evil.example", uv), challenge
+		}},
+		{"missing user verification", func(t *testing.T, a *softAuthenticator, challenge []byte) (*CredentialAssertionResponse, []byte) {
+			return a.assert(challenge, testOrigin, flagUserPresent), challenge
+		}},
+		{"missing user presence", func(t *testing.T, a *softAuthenticator, challenge []byte) (*CredentialAssertionResponse, []byte) {
+			return a.assert(challenge, testOrigin, flagUserVerified), challenge
+		}},
+		{"reused challenge", func(t *testing.T, a *softAuthenticator, challenge []byte) (*CredentialAssertionResponse, []byte) {
+			// An assertion made for an earlier ceremony doesn't work for the current one.
+			return a.assert(challenge, testOrigin, uv), newTestChallenge(t)
+		}},
+		{"invalid signature", func(t *testing.T, a *softAuthenticator, challenge []byte) (*CredentialAssertionResponse, []byte) {
+			res := a.assert(challenge, testOrigin, uv)
+			res.Response.Signature[len(res.Response.Signature)-1] ^= 0xff
+			return res, challenge
+		}},
+		{"other credential", func(t *testing.T, a *softAuthenticator, challenge []byte) (*CredentialAssertionResponse, []byte) {
+			other := newSoftAuthenticator(t, AlgES256)
+			other.id = a.id
+			return other.assert(challenge, testOrigin, uv), challenge
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := newSoftAuthenticator(t, AlgES256)
+			credential := registerCredential(t, rp, a)
+			res, challenge := test.assert(t, a, newTestChallenge(t))
+			if _, err := rp.VerifyAssertion(res, challenge, credential); err == nil {
+				t.Error("assertion was accepted")
+			}
+		})
+	}
+}
+
+func TestVerifyAssertionSignCount(t *testing.T) {
+	rp := newTestRelyingParty()
+	a := newSoftAuthenticator(t, AlgEdDSA)
+	credential := registerCredential(t, rp, a)
+
+	challenge := newTestChallenge(t)
+	res := a.assert(challenge, testOrigin, flagUserPresent|flagUserVerified)
+	signCount, err := rp.VerifyAssertion(res, challenge, credential)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	credential.SignCount = signCount
+
+	// Replaying the same assertion doesn't increase the counter.
+	if _, err := rp.VerifyAssertion(res, challenge, credential); !errors.Is(err, ErrSignCount) {
+		t.Errorf("replayed assertion: got %v, want ErrSignCount", err)
+	}
+
+	// A clone of the authenticator lags behind the counter of the original.
+	a.signCount -= 2
+	challenge = newTestChallenge(t)
+	if _, err := rp.VerifyAssertion(a.assert(challenge, testOrigin, flagUserPresent|flagUserVerified), challenge, credential); !errors.Is(err, ErrSignCount) {
+		t.Errorf("cloned authenticator: got %v, want ErrSignCount", err)
+	}
+}
+
+func TestDecodeCBORTruncated(t *testing.T) {
+	a := newSoftAuthenticator(t, AlgES256)
+	res := a.register(newTestChallenge(t), "packed-x5c")
+	attestationObject := res.Response.AttestationObject
+
+	for i := 0; i < len(attestationObject); i++ {
+		if _, _, err := decodeCBOR(attestationObject[:i]); err == nil {
+			t.Fatalf("decoding %d of %d bytes succeeded", i, len(attestationObject))
+		}
+	}
+	authData := a.authData(flagUserPresent|flagUserVerified|flagAttestedData, true)
+	for i := 0; i < len(authData); i++ {
+		if _, err := parseAuthenticatorData(authData[:i]); err == nil {
+			t.Fatalf("parsing %d of %d bytes of authenticator data succeeded", i, len(authData))
+		}
+	}
+}
+
+func TestDecodeCBORMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"deeply nested arrays", append(bytes.Repeat([]byte{0x81}, 10000), 0x00)},
+		{"deeply nested maps", append(bytes.Repeat([]byte{0xa1, 0x00}, 10000), 0x00)},
+		{"deeply nested tags", append(bytes.Repeat([]byte{0xc6}, 10000), 0x00)},
+		{"huge array length", []byte{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{"huge map length", []byte{0xbb, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{"huge byte string length", []byte{0x5b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00}},
+		{"integer overflow", []byte{0x1b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{"indefinite length", []byte{0x9f, 0x00, 0xff}},
+		{"unsupported map key", []byte{0xa1, 0x40, 0x00}},
+		{"duplicate map key", []byte{0xa2, 0x01, 0x00, 0x01, 0x00}},
+		{"empty", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, _, err := decodeCBOR(test.data); err == nil {
+				t.Error("malformed cbor was decoded")
+			}
+		})
+	}
+}
@@ -6,13 +6,102 @@ create table if not exists users (
     id bigint primary key AUTO_INCREMENT,
     email varchar(255) NOT NULL UNIQUE,
     password varchar(255) NOT NULL,
+    email_verified_at timestamp NULL,
     created_at timestamp default current_timestamp
 );
 
 create table if not exists refresh_tokens_table (
-    user_id bigint UNIQUE,
+    session_id varchar(64) primary key,
+    user_id bigint NOT NULL,
     refresh_token varchar(255) NOT NULL,
     expire_time bigint NOT NULL,
     created_at timestamp default CURRENT_TIMESTAMP,
+    INDEX idx_refresh_tokens_user_id (user_id),
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-);
\ No newline at end of file
+);
+
+create table if not exists security_events (
+    id bigint primary key AUTO_INCREMENT,
+    user_id bigint NOT NULL,
+    session_id varchar(64),
+    event_type varchar(64) NOT NULL,
+    details varchar(255),
+    created_at timestamp default CURRENT_TIMESTAMP,
+    INDEX idx_security_events_user_id (user_id)
+);
+
+create table if not exists revoked_tokens (
+    jti varchar(64) primary key,
+    expire_time bigint NOT NULL,
+    INDEX idx_revoked_tokens_expire_time (expire_time)
+);
+
+create table if not exists user_tokens (
+    id bigint primary key AUTO_INCREMENT,
+    user_id bigint NOT NULL,
+    purpose varchar(32) NOT NULL,
+    token_hash varchar(64) NOT NULL UNIQUE,
+    data varchar(255) NOT NULL DEFAULT '',
+    expire_time bigint NOT NULL,
+    used_at timestamp NULL,
+    created_at timestamp default CURRENT_TIMESTAMP,
+    INDEX idx_user_tokens_user_id_purpose (user_id, purpose),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+create table if not exists auth_attempts (
+    attempt_key varchar(191) primary key,
+    failures int NOT NULL DEFAULT 0,
+    blocked_until bigint NOT NULL DEFAULT 0,
+    expire_time bigint NOT NULL DEFAULT 0,
+    INDEX idx_auth_attempts_expire_time (expire_time)
+);
+
+create table if not exists rate_limits (
+    bucket_key varchar(191) primary key,
+    tokens double NOT NULL,
+    updated_at bigint NOT NULL,
+    expire_time bigint NOT NULL,
+    INDEX idx_rate_limits_expire_time (expire_time)
+);
+
+create table if not exists user_mfa (
+    user_id bigint primary key,
+    totp_secret varchar(255) NOT NULL,
+    last_used_step bigint NOT NULL DEFAULT 0,
+    enabled_at timestamp NULL,
+    created_at timestamp default CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+create table if not exists mfa_recovery_codes (
+    id bigint primary key AUTO_INCREMENT,
+    user_id bigint NOT NULL,
+    code_hash varchar(64) NOT NULL,
+    used_at timestamp NULL,
+    UNIQUE INDEX idx_mfa_recovery_codes_user_id_code_hash (user_id, code_hash),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+create table if not exists webauthn_credentials (
+    id bigint primary key AUTO_INCREMENT,
+    user_id bigint NOT NULL,
+    credential_id varbinary(1023) NOT NULL UNIQUE,
+    public_key blob NOT NULL,
+    sign_count bigint NOT NULL DEFAULT 0,
+    transports varchar(255) NOT NULL DEFAULT '',
+    name varchar(255) NOT NULL DEFAULT '',
+    created_at timestamp default CURRENT_TIMESTAMP,
+    last_used_at timestamp NULL,
+    INDEX idx_webauthn_credentials_user_id (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+create table if not exists webauthn_challenges (
+    challenge_hash varchar(64) primary key,
+    user_id bigint NULL,
+    ceremony varchar(16) NOT NULL,
+    expire_time bigint NOT NULL,
+    INDEX idx_webauthn_challenges_expire_time (expire_time),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
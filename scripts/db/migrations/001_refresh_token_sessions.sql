@@ -0,0 +1,16 @@
+-- Allows several refresh-token sessions per user, one per login.
+-- Refresh tokens issued before this migration carry no session id and can't be
+-- matched to a session anymore, so the existing rows are dropped and users have
+-- to log in again.
+use golang_jwt_auth;
+
+delete from refresh_tokens_table;
+
+alter table refresh_tokens_table
+    add column session_id varchar(64) NOT NULL first,
+    modify user_id bigint NOT NULL,
+    add index idx_refresh_tokens_user_id (user_id);
+
+alter table refresh_tokens_table
+    drop index user_id,
+    add primary key (session_id);
@@ -0,0 +1,12 @@
+-- Records security relevant events such as refresh token reuse.
+use golang_jwt_auth;
+
+create table if not exists security_events (
+    id bigint primary key AUTO_INCREMENT,
+    user_id bigint NOT NULL,
+    session_id varchar(64),
+    event_type varchar(64) NOT NULL,
+    details varchar(255),
+    created_at timestamp default CURRENT_TIMESTAMP,
+    INDEX idx_security_events_user_id (user_id)
+);
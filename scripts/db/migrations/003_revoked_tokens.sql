@@ -0,0 +1,8 @@
+-- Access token denylist used when REVOCATION_STORE=db.
+use golang_jwt_auth;
+
+create table if not exists revoked_tokens (
+    jti varchar(64) primary key,
+    expire_time bigint NOT NULL,
+    INDEX idx_revoked_tokens_expire_time (expire_time)
+);
@@ -0,0 +1,19 @@
+-- Email verification of new accounts and the single-use tokens sent by email.
+-- Accounts created before this migration are treated as verified.
+use golang_jwt_auth;
+
+alter table users add column email_verified_at timestamp NULL after password;
+update users set email_verified_at = created_at;
+
+create table if not exists user_tokens (
+    id bigint primary key AUTO_INCREMENT,
+    user_id bigint NOT NULL,
+    purpose varchar(32) NOT NULL,
+    token_hash varchar(64) NOT NULL UNIQUE,
+    data varchar(255) NOT NULL DEFAULT '',
+    expire_time bigint NOT NULL,
+    used_at timestamp NULL,
+    created_at timestamp default CURRENT_TIMESTAMP,
+    INDEX idx_user_tokens_user_id_purpose (user_id, purpose),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
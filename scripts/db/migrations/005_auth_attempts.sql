@@ -0,0 +1,10 @@
+-- Failed login counters for ATTEMPT_STORE=db.
+use golang_jwt_auth;
+
+create table if not exists auth_attempts (
+    attempt_key varchar(191) primary key,
+    failures int NOT NULL DEFAULT 0,
+    blocked_until bigint NOT NULL DEFAULT 0,
+    expire_time bigint NOT NULL DEFAULT 0,
+    INDEX idx_auth_attempts_expire_time (expire_time)
+);
@@ -0,0 +1,10 @@
+-- Token buckets for RATE_LIMIT_STORE=db.
+use golang_jwt_auth;
+
+create table if not exists rate_limits (
+    bucket_key varchar(191) primary key,
+    tokens double NOT NULL,
+    updated_at bigint NOT NULL,
+    expire_time bigint NOT NULL,
+    INDEX idx_rate_limits_expire_time (expire_time)
+);
@@ -0,0 +1,21 @@
+-- TOTP two-factor authentication. The secrets are encrypted with MFA_ENCRYPTION_KEY,
+-- the recovery codes are stored as hashes only.
+use golang_jwt_auth;
+
+create table if not exists user_mfa (
+    user_id bigint primary key,
+    totp_secret varchar(255) NOT NULL,
+    last_used_step bigint NOT NULL DEFAULT 0,
+    enabled_at timestamp NULL,
+    created_at timestamp default CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+create table if not exists mfa_recovery_codes (
+    id bigint primary key AUTO_INCREMENT,
+    user_id bigint NOT NULL,
+    code_hash varchar(64) NOT NULL,
+    used_at timestamp NULL,
+    UNIQUE INDEX idx_mfa_recovery_codes_user_id_code_hash (user_id, code_hash),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,25 @@
+-- Passkeys (WebAuthn credentials) and the challenges of running ceremonies.
+use golang_jwt_auth;
+
+create table if not exists webauthn_credentials (
+    id bigint primary key AUTO_INCREMENT,
+    user_id bigint NOT NULL,
+    credential_id varbinary(1023) NOT NULL UNIQUE,
+    public_key blob NOT NULL,
+    sign_count bigint NOT NULL DEFAULT 0,
+    transports varchar(255) NOT NULL DEFAULT '',
+    name varchar(255) NOT NULL DEFAULT '',
+    created_at timestamp default CURRENT_TIMESTAMP,
+    last_used_at timestamp NULL,
+    INDEX idx_webauthn_credentials_user_id (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+create table if not exists webauthn_challenges (
+    challenge_hash varchar(64) primary key,
+    user_id bigint NULL,
+    ceremony varchar(16) NOT NULL,
+    expire_time bigint NOT NULL,
+    INDEX idx_webauthn_challenges_expire_time (expire_time),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);